@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/Dataman-Cloud/swancfg/types"
+)
+
+// ListOptions narrows down the apps returned by ListApps.
+type ListOptions struct {
+	// Fields are swan field filters such as "runAs==nmg". They are joined
+	// with commas into the fields query parameter.
+	Fields []string
+}
+
+func (o *ListOptions) query() url.Values {
+	if o == nil || len(o.Fields) == 0 {
+		return nil
+	}
+
+	return url.Values{"fields": []string{strings.Join(o.Fields, ",")}}
+}
+
+// ListApps returns the apps matching opts. A nil opts lists every app.
+func (c *Client) ListApps(ctx context.Context, opts *ListOptions) ([]*types.App, error) {
+	var apps []*types.App
+	if err := c.do(ctx, "GET", "/apps", opts.query(), nil, &apps); err != nil {
+		return nil, err
+	}
+
+	return apps, nil
+}
+
+// GetApp returns the app with the given id, including its tasks.
+func (c *Client) GetApp(ctx context.Context, id string) (*types.App, error) {
+	var app *types.App
+	if err := c.do(ctx, "GET", "/apps/"+url.PathEscape(id), nil, nil, &app); err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// CreateApp submits a new app to swan.
+func (c *Client) CreateApp(ctx context.Context, spec *types.Spec) error {
+	return c.do(ctx, "POST", "/apps", nil, spec, nil)
+}
+
+// DeleteApp removes the app with the given id.
+func (c *Client) DeleteApp(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "/apps/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// UpdateApp starts a rolling update of the app to a new version. Swan
+// updates the first instance and waits for ProceedUpdate to continue.
+func (c *Client) UpdateApp(ctx context.Context, id string, spec *types.Spec) error {
+	return c.do(ctx, "PUT", "/apps/"+url.PathEscape(id), nil, spec, nil)
+}
+
+// ProceedUpdate moves the given number of further instances of an app
+// being updated to the new version.
+func (c *Client) ProceedUpdate(ctx context.Context, id string, instances int) error {
+	body := map[string]int{"instances": instances}
+	return c.do(ctx, "PATCH", "/apps/"+url.PathEscape(id)+"/proceed-update", nil, body, nil)
+}
+
+// CancelUpdate aborts a rolling update and returns every instance to the
+// previous version.
+func (c *Client) CancelUpdate(ctx context.Context, id string) error {
+	return c.do(ctx, "PATCH", "/apps/"+url.PathEscape(id)+"/cancel-update", nil, nil, nil)
+}
+
+// ScaleApp changes the number of instances of an app.
+func (c *Client) ScaleApp(ctx context.Context, id string, instances int) error {
+	body := map[string]int{"instances": instances}
+	return c.do(ctx, "PATCH", "/apps/"+url.PathEscape(id)+"/scale", nil, body, nil)
+}
+
+// ListVersions returns every version swan keeps for an app.
+func (c *Client) ListVersions(ctx context.Context, id string) ([]*types.Version, error) {
+	var versions []*types.Version
+	if err := c.do(ctx, "GET", "/apps/"+url.PathEscape(id)+"/versions", nil, nil, &versions); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
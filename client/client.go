@@ -0,0 +1,210 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a single request when no timeout is configured.
+	DefaultTimeout = 10 * time.Second
+
+	userAgent = "swancfg/0.1"
+)
+
+// transport is shared by every client so that connections to the same
+// swan endpoint are reused across commands.
+var transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// Client talks to a single swan endpoint.
+type Client struct {
+	addr     string
+	http     *http.Client
+	username string
+	password string
+	observe  func(*Exchange)
+}
+
+// Exchange describes a request sent to swan and how it ended.
+type Exchange struct {
+	Method     string
+	Path       string
+	Body       []byte
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout sets the timeout applied to every request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.http.Timeout = timeout
+	}
+}
+
+// WithHTTPClient replaces the underlying http client.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithBasicAuth sends the given credentials with every request.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithObserver calls observe after every request, whether it succeeded
+// or not.
+func WithObserver(observe func(*Exchange)) Option {
+	return func(c *Client) {
+		c.observe = observe
+	}
+}
+
+// New returns a client for the swan endpoint at addr.
+func New(addr string, opts ...Option) *Client {
+	c := &Client{
+		addr: strings.TrimRight(addr, "/"),
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   DefaultTimeout,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Addr returns the swan endpoint the client talks to.
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// do sends a request to swan and decodes a successful response into out.
+// Non-2xx responses are turned into an *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response of %s %s failed: %s", method, path, err.Error())
+	}
+
+	return nil
+}
+
+// send performs the request and checks the status code. The caller owns
+// the body of the returned response.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Response, error) {
+	if c.addr == "" {
+		return nil, fmt.Errorf("swan address not configured")
+	}
+
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var (
+		body    io.Reader
+		payload []byte
+	)
+	if in != nil {
+		var err error
+		payload, err = json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request failed: %s", err.Error())
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("make new request failed: %s", err.Error())
+	}
+	req = req.WithContext(ctx)
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		err = fmt.Errorf("%s %s failed: %s", method, u, err.Error())
+		c.notify(method, path, payload, 0, start, err)
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer closeBody(resp)
+		err := newAPIError(method, path, resp)
+		c.notify(method, path, payload, resp.StatusCode, start, err)
+		return nil, err
+	}
+
+	c.notify(method, path, payload, resp.StatusCode, start, nil)
+	return resp, nil
+}
+
+func (c *Client) notify(method, path string, body []byte, status int, start time.Time, err error) {
+	if c.observe == nil {
+		return
+	}
+
+	c.observe(&Exchange{
+		Method:     method,
+		Path:       path,
+		Body:       body,
+		StatusCode: status,
+		Duration:   time.Since(start),
+		Err:        err,
+	})
+}
+
+// closeBody drains and closes the response body so that the underlying
+// connection can be reused.
+func closeBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when swan answers with a non-2xx status code.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 returned by swan.
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 returned by swan.
+func IsConflict(err error) bool {
+	return statusCode(err) == http.StatusConflict
+}
+
+// IsUnsupported reports whether err means swan doesn't serve the
+// requested endpoint.
+func IsUnsupported(err error) bool {
+	switch statusCode(err) {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+
+	return false
+}
+
+func statusCode(err error) int {
+	if e, ok := err.(*APIError); ok {
+		return e.StatusCode
+	}
+
+	return 0
+}
+
+// newAPIError builds an APIError from a failed response. Swan reports
+// errors as {"error": "..."} or {"message": "..."}; anything else is kept
+// verbatim.
+func newAPIError(method, path string, resp *http.Response) *APIError {
+	e := &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: resp.StatusCode,
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return e
+	}
+
+	var body struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err == nil {
+		if body.Error != "" {
+			e.Message = body.Error
+			return e
+		}
+		if body.Message != "" {
+			e.Message = body.Message
+			return e
+		}
+	}
+
+	e.Message = strings.TrimSpace(string(data))
+
+	return e
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/types"
+)
+
+// EventStream decodes the server-sent events swan publishes on /events.
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Events subscribes to the event stream of swan, optionally narrowed down
+// to one app. The stream is not subject to the client timeout.
+func (c *Client) Events(ctx context.Context, appId string) (*EventStream, error) {
+	var query url.Values
+	if appId != "" {
+		query = url.Values{"appId": []string{appId}}
+	}
+
+	hc := *c.http
+	hc.Timeout = 0
+	stream := *c
+	stream.http = &hc
+
+	resp, err := stream.send(ctx, "GET", "/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &EventStream{
+		body:    resp.Body,
+		scanner: scanner,
+	}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF once swan
+// closes the stream.
+func (s *EventStream) Next() (*types.Event, error) {
+	var name string
+	var data []string
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				return decodeEvent(name, strings.Join(data, "\n")), nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// Close ends the subscription.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+// decodeEvent maps a swan event onto types.Event, keeping the swan event
+// name as its type.
+func decodeEvent(name, data string) *types.Event {
+	var raw struct {
+		AppId   string `json:"appId"`
+		TaskId  string `json:"taskId"`
+		ID      string `json:"id"`
+		RunAs   string `json:"runAs"`
+		State   string `json:"state"`
+		Status  string `json:"status"`
+		Healthy *bool  `json:"healthy"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		raw.Message = data
+	}
+
+	e := &types.Event{
+		Type:    name,
+		Time:    time.Now(),
+		AppId:   raw.AppId,
+		TaskId:  raw.TaskId,
+		RunAs:   raw.RunAs,
+		State:   raw.State,
+		Healthy: raw.Healthy,
+		Reason:  raw.Reason,
+	}
+	if e.TaskId == "" && e.AppId != raw.ID {
+		e.TaskId = raw.ID
+	}
+	if e.State == "" {
+		e.State = raw.Status
+	}
+	if e.Reason == "" {
+		e.Reason = raw.Message
+	}
+
+	return e
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// readChunk bounds a single read of a sandbox file.
+const readChunk = 64 * 1024
+
+// Mesos locates task sandboxes through a mesos master.
+type Mesos struct {
+	master *Client
+}
+
+// NewMesos returns a client for the mesos master at addr.
+func NewMesos(addr string, opts ...Option) *Mesos {
+	return &Mesos{master: New(addr, opts...)}
+}
+
+// Sandbox is the working directory of a task on its mesos agent.
+type Sandbox struct {
+	agent     *Client
+	Directory string
+}
+
+type mesosAgent struct {
+	ID       string `json:"id"`
+	PID      string `json:"pid"`
+	Hostname string `json:"hostname"`
+}
+
+type mesosExecutor struct {
+	ID             string      `json:"id"`
+	Directory      string      `json:"directory"`
+	Tasks          []mesosTask `json:"tasks"`
+	QueuedTasks    []mesosTask `json:"queued_tasks"`
+	CompletedTasks []mesosTask `json:"completed_tasks"`
+}
+
+type mesosTask struct {
+	ID string `json:"id"`
+}
+
+type mesosFramework struct {
+	Executors          []mesosExecutor `json:"executors"`
+	CompletedExecutors []mesosExecutor `json:"completed_executors"`
+}
+
+func (e *mesosExecutor) runs(taskId string) bool {
+	if e.ID == taskId {
+		return true
+	}
+
+	for _, tasks := range [][]mesosTask{e.Tasks, e.QueuedTasks, e.CompletedTasks} {
+		for _, t := range tasks {
+			if t.ID == taskId {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Sandbox finds the sandbox of taskId on the agent agentId.
+func (m *Mesos) Sandbox(ctx context.Context, agentId, taskId string) (*Sandbox, error) {
+	var master struct {
+		Agents []mesosAgent `json:"slaves"`
+	}
+	if err := m.master.do(ctx, "GET", "/master/state", nil, nil, &master); err != nil {
+		return nil, err
+	}
+
+	var addr string
+	for _, a := range master.Agents {
+		if a.ID == agentId {
+			addr = agentAddr(a.PID)
+			break
+		}
+	}
+
+	if addr == "" {
+		return nil, fmt.Errorf("mesos agent %s not found", agentId)
+	}
+
+	agent := &Client{
+		addr:     addr,
+		http:     m.master.http,
+		username: m.master.username,
+		password: m.master.password,
+	}
+
+	var state struct {
+		Frameworks          []mesosFramework `json:"frameworks"`
+		CompletedFrameworks []mesosFramework `json:"completed_frameworks"`
+	}
+	if err := agent.do(ctx, "GET", "/state", nil, nil, &state); err != nil {
+		return nil, err
+	}
+
+	for _, frameworks := range [][]mesosFramework{state.Frameworks, state.CompletedFrameworks} {
+		for _, f := range frameworks {
+			for _, executors := range [][]mesosExecutor{f.Executors, f.CompletedExecutors} {
+				for _, e := range executors {
+					if e.runs(taskId) {
+						return &Sandbox{agent: agent, Directory: e.Directory}, nil
+					}
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("sandbox of task %s not found on agent %s", taskId, agentId)
+}
+
+// Read returns the content of file in the sandbox starting at offset, and
+// the offset to continue reading from.
+func (s *Sandbox) Read(ctx context.Context, file string, offset int64) (string, int64, error) {
+	var data []string
+	for {
+		query := url.Values{
+			"path":   []string{s.Directory + "/" + file},
+			"offset": []string{strconv.FormatInt(offset, 10)},
+			"length": []string{strconv.Itoa(readChunk)},
+		}
+
+		var chunk struct {
+			Data   string `json:"data"`
+			Offset int64  `json:"offset"`
+		}
+		if err := s.agent.do(ctx, "GET", "/files/read", query, nil, &chunk); err != nil {
+			return strings.Join(data, ""), offset, err
+		}
+
+		if chunk.Data == "" {
+			return strings.Join(data, ""), offset, nil
+		}
+
+		data = append(data, chunk.Data)
+		offset = chunk.Offset + int64(len(chunk.Data))
+	}
+}
+
+// agentAddr turns an agent pid such as slave(1)@10.0.0.1:5051 into its
+// http address.
+func agentAddr(pid string) string {
+	if i := strings.LastIndex(pid, "@"); i >= 0 {
+		pid = pid[i+1:]
+	}
+
+	if pid == "" {
+		return ""
+	}
+
+	return "http://" + pid
+}
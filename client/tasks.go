@@ -0,0 +1,21 @@
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+// KillTask kills a task of an app. Swan schedules a new task for its slot.
+func (c *Client) KillTask(ctx context.Context, appId, taskId string) error {
+	return c.do(ctx, "DELETE", taskPath(appId, taskId), nil, nil, nil)
+}
+
+// RestartTask replaces a task of an app with a new one of the same
+// version.
+func (c *Client) RestartTask(ctx context.Context, appId, taskId string) error {
+	return c.do(ctx, "PATCH", taskPath(appId, taskId)+"/restart", nil, nil, nil)
+}
+
+func taskPath(appId, taskId string) string {
+	return "/apps/" + url.PathEscape(appId) + "/tasks/" + url.PathEscape(taskId)
+}
@@ -0,0 +1,652 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// Apps created or updated by apply carry this label, and only those are
+// deleted by apply --prune.
+const (
+	managedByLabel = "managed-by"
+	managedByValue = "swancfg"
+)
+
+// Actions of an apply plan.
+const (
+	applyCreate    = "create"
+	applyUpdate    = "update"
+	applyScale     = "scale"
+	applyDelete    = "delete"
+	applyUnchanged = "unchanged"
+)
+
+var applySymbols = map[string]string{
+	applyCreate: "+",
+	applyUpdate: "~",
+	applyScale:  "~",
+	applyDelete: "-",
+}
+
+// NewApplyCommand returns the CLI command for "apply"
+func NewApplyCommand() cli.Command {
+	return cli.Command{
+		Name:  "apply",
+		Usage: "create, update and delete applications to match spec files",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "from-file, f",
+				Usage: "Apply spec `FILE`, or every spec file under a directory, - for stdin",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the plan without changing anything",
+			},
+			cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete apps managed by swancfg that have no spec file",
+			},
+			cli.BoolFlag{
+				Name:  "yes, y",
+				Usage: "Apply the plan without asking for confirmation",
+			},
+			cli.BoolFlag{
+				Name:  "disable-quota",
+				Usage: "Disable quota check",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: time.Minute,
+				Usage: "Time to wait for each changed application",
+			},
+		}, templateFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := applySpecs(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// specChange is one field in which a live app differs from its spec.
+type specChange struct {
+	Path string
+	From string
+	To   string
+}
+
+func (c *specChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.From, c.To)
+}
+
+// applyStep is what apply does to one app.
+type applyStep struct {
+	Action  string
+	AppId   string
+	Cluster string
+	File    string
+	Spec    *types.Spec
+	App     *types.App
+	Changes []*specChange
+
+	// Doc is the document of the spec file, telling the fields it sets.
+	// Every field is compared with the live app when it is nil.
+	Doc interface{}
+}
+
+// applyPlan is the list of steps bringing the clusters to the spec files.
+type applyPlan struct {
+	Steps   []*applyStep
+	clients map[string]*client.Client
+}
+
+func (p *applyPlan) count(action string) int {
+	var n int
+	for _, step := range p.Steps {
+		if step.Action == action {
+			n++
+		}
+	}
+
+	return n
+}
+
+// applySpecs executes the "apply" command.
+func applySpecs(c *cli.Context) error {
+	path := c.String("from-file")
+	if path == "" {
+		return fmt.Errorf("Spec file or directory must be specified for applying applications")
+	}
+
+	if path == "-" && !c.Bool("yes") && !c.Bool("dry-run") {
+		return fmt.Errorf("--yes required when reading specs from stdin")
+	}
+
+	vars, err := specVars(c)
+	if err != nil {
+		return err
+	}
+
+	files, err := specFiles(path)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no spec files found in %s", path)
+	}
+
+	plan := &applyPlan{clients: make(map[string]*client.Client)}
+	desired := make(map[string]*applyStep)
+	for _, file := range files {
+		f, err := readValidSpec(file, vars)
+		if err != nil {
+			return err
+		}
+
+		spec, err := f.Spec()
+		if err != nil {
+			return err
+		}
+
+		if err := completeSpec(spec); err != nil {
+			return err
+		}
+
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		spec.Labels[managedByLabel] = managedByValue
+		if doc, ok := f.Doc.(map[string]interface{}); ok {
+			if _, ok := setField(doc, "Labels"); !ok {
+				doc["labels"] = nil
+			}
+		}
+
+		appId := specAppID(spec)
+		if prev, ok := desired[appId]; ok {
+			return fmt.Errorf("app %s is defined by both %s and %s", appId, prev.File, file)
+		}
+
+		step := &applyStep{AppId: appId, Cluster: spec.Cluster, File: file, Spec: spec, Doc: f.Doc}
+		desired[appId] = step
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	if err := plan.diff(c.Bool("prune"), desired); err != nil {
+		return err
+	}
+
+	printPlan(plan)
+
+	changes := len(plan.Steps) - plan.count(applyUnchanged)
+	if changes == 0 || c.Bool("dry-run") {
+		return nil
+	}
+
+	if !c.Bool("yes") && !confirm("Do you want to apply these changes?") {
+		return fmt.Errorf("apply cancelled")
+	}
+
+	var failed int
+	for _, step := range plan.Steps {
+		if step.Action == applyUnchanged {
+			continue
+		}
+
+		if err := plan.apply(step, c.Bool("disable-quota"), c.Duration("wait")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s %s: %s\n", step.Action, step.AppId, err)
+			failed++
+		}
+	}
+
+	fmt.Printf("===> apply complete: %d changed, %d failed\n", changes-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes failed", failed, changes)
+	}
+
+	return nil
+}
+
+// specFiles returns path itself, or the spec files under path when it is
+// a directory.
+func specFiles(path string) ([]string, error) {
+	if path == "-" {
+		return []string{path}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if file != path && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".json", ".yml", ".yaml", ".toml":
+			files = append(files, file)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+func (p *applyPlan) client(cluster string) (*client.Client, error) {
+	if swan, ok := p.clients[cluster]; ok {
+		return swan, nil
+	}
+
+	swan, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[cluster] = swan
+
+	return swan, nil
+}
+
+// diff compares the desired apps with the live ones and decides what to
+// do with each of them.
+func (p *applyPlan) diff(prune bool, desired map[string]*applyStep) error {
+	ctx := context.Background()
+
+	for _, step := range p.Steps {
+		swan, err := p.client(step.Cluster)
+		if err != nil {
+			return err
+		}
+
+		app, err := swan.GetApp(ctx, step.AppId)
+		if err != nil {
+			if client.IsNotFound(err) {
+				step.Action = applyCreate
+				continue
+			}
+			return err
+		}
+		step.App = app
+
+		changes, err := specChanges(liveSpec(app), step.Spec, step.Doc)
+		if err != nil {
+			return err
+		}
+		step.Changes = changes
+
+		switch {
+		case len(changes) == 0:
+			step.Action = applyUnchanged
+		case len(changes) == 1 && changes[0].Path == "instances":
+			step.Action = applyScale
+		default:
+			step.Action = applyUpdate
+		}
+	}
+
+	if prune {
+		if err := p.prune(desired); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(p.Steps, func(i, j int) bool { return p.Steps[i].Cluster < p.Steps[j].Cluster })
+
+	return nil
+}
+
+// prune plans deleting the apps managed by swancfg which aren't desired
+// anymore, in every cluster the spec files deploy to.
+func (p *applyPlan) prune(desired map[string]*applyStep) error {
+	ctx := context.Background()
+
+	clusters := make([]string, 0, len(p.clients))
+	for cluster := range p.clients {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	for _, cluster := range clusters {
+		swan := p.clients[cluster]
+		apps, err := swan.ListApps(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, app := range apps {
+			if _, ok := desired[app.ID]; ok {
+				continue
+			}
+
+			detail, err := swan.GetApp(ctx, app.ID)
+			if err != nil {
+				if client.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+
+			spec := detail.CurrentVersion
+			if spec == nil || spec.Labels[managedByLabel] != managedByValue {
+				continue
+			}
+
+			p.Steps = append(p.Steps, &applyStep{
+				Action:  applyDelete,
+				AppId:   detail.ID,
+				Cluster: cluster,
+				App:     detail,
+			})
+		}
+	}
+
+	return nil
+}
+
+// apply carries out one step of the plan.
+func (p *applyPlan) apply(step *applyStep, disableQuota bool, wait time.Duration) error {
+	ctx := context.Background()
+	swan := p.clients[step.Cluster]
+
+	if !disableQuota && step.Action != applyDelete {
+		need := specNeed(step.Spec, int(step.Spec.Instances))
+		if step.App != nil {
+			// Only what the app uses beyond its current version counts.
+			need.subtract(specNeed(liveSpec(step.App), step.App.Instances))
+		} else {
+			need.Apps = 1
+		}
+
+		if need.grows() {
+			if err := checkQuotaFor(step.Spec.RunAs, step.Cluster, need); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch step.Action {
+	case applyCreate:
+		fmt.Printf("===> creating %s in cluster:%s...", step.AppId, step.Cluster)
+		if err := swan.CreateApp(ctx, step.Spec); err != nil {
+			fmt.Println("failed")
+			return err
+		}
+		fmt.Println("done")
+
+		if err := waitForInstances(swan, step.AppId, int(step.Spec.Instances), wait); err != nil {
+			return err
+		}
+		fmt.Printf("===> application %s created\n", step.AppId)
+	case applyScale:
+		target := int(step.Spec.Instances)
+		fmt.Printf("===> scaling %s from %d to %d instances...", step.AppId, step.App.Instances, target)
+		if err := swan.ScaleApp(ctx, step.AppId, target); err != nil {
+			fmt.Println("failed")
+			return err
+		}
+		fmt.Println("done")
+
+		if err := waitForInstances(swan, step.AppId, target, wait); err != nil {
+			return err
+		}
+		fmt.Printf("===> application %s scaled to %d instances\n", step.AppId, target)
+	case applyUpdate:
+		return newRollout(swan, step.App, step.Spec, wait).run(step.Spec)
+	case applyDelete:
+		fmt.Printf("===> deleting %s from cluster:%s...", step.AppId, step.Cluster)
+		if err := swan.DeleteApp(ctx, step.AppId); err != nil {
+			fmt.Println("failed")
+			return err
+		}
+		fmt.Println("done")
+	}
+
+	return nil
+}
+
+func printPlan(plan *applyPlan) {
+	var cluster string
+	for _, step := range plan.Steps {
+		if step.Action == applyUnchanged {
+			continue
+		}
+
+		if step.Cluster != cluster {
+			cluster = step.Cluster
+			fmt.Printf("===> plan for cluster:%s\n", cluster)
+		}
+
+		fmt.Printf("  %s %s (%s)\n", applySymbols[step.Action], step.AppId, step.Action)
+		for _, change := range step.Changes {
+			fmt.Printf("      %s\n", change)
+		}
+	}
+
+	if plan.count(applyUnchanged) == len(plan.Steps) {
+		fmt.Printf("No changes, %d apps up to date.\n", len(plan.Steps))
+		return
+	}
+
+	fmt.Printf("Plan: %d to create, %d to update, %d to scale, %d to delete, %d unchanged.\n",
+		plan.count(applyCreate), plan.count(applyUpdate), plan.count(applyScale),
+		plan.count(applyDelete), plan.count(applyUnchanged))
+}
+
+// confirm asks the user a yes/no question on the terminal.
+func confirm(question string) bool {
+	fmt.Printf("%s Only 'yes' will be accepted: ", question)
+
+	var answer string
+	fmt.Scanln(&answer)
+
+	return answer == "yes"
+}
+
+// specChanges lists the fields in which desired differs from live. Only
+// the fields set, the spec file document, counts; the others are filled
+// by swan. A nil set compares every field.
+func specChanges(live, desired *types.Spec, set interface{}) ([]*specChange, error) {
+	liveDoc, err := specDoc(live)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredDoc, err := specDoc(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*specChange
+	diffDoc("", liveDoc, desiredDoc, set, &changes)
+
+	return changes, nil
+}
+
+// specDoc turns a spec into the generic document its json decodes to.
+func specDoc(spec *types.Spec) (interface{}, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// setField looks the field key up in set, the part of a spec file
+// document at some path, matching names like encoding/json. It returns
+// what the file sets below the field. Everything is set below a nil set,
+// or anything but an object.
+func setField(set interface{}, key string) (interface{}, bool) {
+	m, ok := set.(map[string]interface{})
+	if !ok {
+		return nil, true
+	}
+
+	for name, val := range m {
+		if strings.EqualFold(name, key) {
+			return val, true
+		}
+	}
+
+	return nil, false
+}
+
+// setItem returns what set, a part of a spec file document, sets in the
+// item i of a list.
+func setItem(set interface{}, i int) interface{} {
+	if list, ok := set.([]interface{}); ok && i < len(list) {
+		return list[i]
+	}
+
+	return nil
+}
+
+// diffDoc adds the differences between the live and desired documents to
+// changes, skipping the fields missing from set. Labels and env are data:
+// a key missing from desired is removed.
+func diffDoc(path string, live, desired, set interface{}, changes *[]*specChange) {
+	if reflect.DeepEqual(live, desired) || (isNoneDoc(live) && isNoneDoc(desired)) {
+		return
+	}
+
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(d)+len(l))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		for key := range l {
+			if _, ok := d[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		// Only labels and env are maps, every other key is a field name.
+		data := path == "labels" || path == "env"
+		for _, key := range keys {
+			var below interface{}
+			if !data {
+				var ok bool
+				if below, ok = setField(set, key); !ok {
+					continue
+				}
+			}
+
+			sub := key
+			if !data {
+				sub = strings.ToLower(key[:1]) + key[1:]
+			}
+			if path != "" {
+				sub = path + "." + sub
+			}
+
+			lv, lok := l[key]
+			dv, dok := d[key]
+			switch {
+			case !dok:
+				*changes = append(*changes, &specChange{Path: sub, From: docString(lv), To: "(removed)"})
+			case !lok:
+				*changes = append(*changes, &specChange{Path: sub, From: "(none)", To: docString(dv)})
+			default:
+				diffDoc(sub, lv, dv, below, changes)
+			}
+		}
+		return
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			break
+		}
+
+		for i := range d {
+			diffDoc(fmt.Sprintf("%s[%d]", path, i), l[i], d[i], setItem(set, i), changes)
+		}
+		return
+	}
+
+	*changes = append(*changes, &specChange{Path: path, From: docString(live), To: docString(desired)})
+}
+
+// isEmptyDoc reports whether val is the zero value of its field.
+func isEmptyDoc(val interface{}) bool {
+	switch v := val.(type) {
+	case bool:
+		return !v
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	}
+
+	return isNoneDoc(val)
+}
+
+// isNoneDoc reports whether val holds nothing: null, "" or an empty
+// object or list. Unlike false and 0, those aren't told apart.
+func isNoneDoc(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+func docString(val interface{}) string {
+	if isNoneDoc(val) {
+		return "(none)"
+	}
+
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprint(val)
+	}
+
+	return string(data)
+}
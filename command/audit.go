@@ -0,0 +1,379 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+var (
+	// auditLogPath is a JSON lines file audit records are appended to, in
+	// addition to the store.
+	auditLogPath string
+
+	// auditCommand is the command line being run, without global flags
+	// and with the values of flags redacted.
+	auditCommand string
+)
+
+// auditRedacted replaces the values of flags in audited command lines.
+const auditRedacted = "***"
+
+// NewAuditCommand returns the CLI command for "audit"
+func NewAuditCommand() cli.Command {
+	return cli.Command{
+		Name:  "audit",
+		Usage: "show the requests which changed applications",
+		Subcommands: []cli.Command{
+			{
+				Name:  "list",
+				Usage: "list audit records, oldest first",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "user",
+						Usage: "Only records of the OS user [USER]",
+					},
+					cli.StringFlag{
+						Name:  "app",
+						Usage: "Only records of the app [APP-ID]",
+					},
+					cli.StringFlag{
+						Name:  "since",
+						Usage: "Only records after a time, as 2006-01-02, RFC3339 or a duration ago like 24h",
+					},
+					cli.StringFlag{
+						Name:  "until",
+						Usage: "Only records before a time, in the format of --since",
+					},
+				}, outputFlags()...),
+				Action: func(c *cli.Context) error {
+					if err := listAudit(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "show an audit record with the spec sent",
+				ArgsUsage: "[id]",
+				Action: func(c *cli.Context) error {
+					if err := showAudit(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// auditObserver returns the observer of the swan client of cluster,
+// recording every request which isn't a read.
+func auditObserver(cluster *Cluster) func(*client.Exchange) {
+	return func(e *client.Exchange) {
+		if e.Method == "GET" || e.Method == "HEAD" {
+			return
+		}
+
+		record := &types.AuditRecord{
+			Time:     time.Now().Add(-e.Duration),
+			User:     whoami(),
+			Command:  auditCommand,
+			Context:  cluster.Name,
+			Remote:   cluster.Swan,
+			Method:   e.Method,
+			Path:     e.Path,
+			AppID:    auditAppID(e.Path, e.Body),
+			Status:   e.StatusCode,
+			Duration: e.Duration,
+		}
+		if len(e.Body) > 0 {
+			record.Spec = json.RawMessage(e.Body)
+		}
+		if e.Err != nil {
+			record.Error = e.Err.Error()
+		}
+
+		if err := writeAuditRecord(record); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: write audit record failed:", err)
+		}
+	}
+}
+
+// auditCommandLine returns args, the command line of a command of app,
+// with the values of its flags redacted: they may be secrets, like those
+// of --set or --password. Commands and their arguments, such as app ids,
+// are kept. Values are told apart from arguments by the flags of the
+// command run; those of unknown flags are redacted too.
+func auditCommandLine(app *cli.App, args []string) string {
+	var (
+		words    []string
+		flags    []cli.Flag
+		commands = app.Commands
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return strings.Join(append(words, args[i:]...), " ")
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			if j := strings.Index(arg, "="); j >= 0 {
+				words = append(words, arg[:j+1]+auditRedacted)
+				continue
+			}
+
+			words = append(words, arg)
+			if flagTakesValue(flags, strings.TrimLeft(arg, "-")) && i+1 < len(args) {
+				words = append(words, auditRedacted)
+				i++
+			}
+		default:
+			words = append(words, arg)
+
+			var next []cli.Command
+			for _, cmd := range commands {
+				if cmd.HasName(arg) {
+					flags, next = cmd.Flags, cmd.Subcommands
+					break
+				}
+			}
+			commands = next
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// flagTakesValue reports whether the flag name of flags is followed by a
+// value, which unknown flags are assumed to be.
+func flagTakesValue(flags []cli.Flag, name string) bool {
+	for _, flag := range flags {
+		for _, n := range strings.Split(flag.GetName(), ",") {
+			if strings.TrimSpace(n) != name {
+				continue
+			}
+
+			switch flag.(type) {
+			case cli.BoolFlag, cli.BoolTFlag:
+				return false
+			}
+			return true
+		}
+	}
+
+	return true
+}
+
+// auditAppID returns the app a request is about, from its path or, for a
+// new app, from its spec.
+func auditAppID(path string, body []byte) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "apps" {
+		if id, err := url.PathUnescape(parts[1]); err == nil {
+			return id
+		}
+		return parts[1]
+	}
+
+	spec := &types.Spec{}
+	if len(parts) == 1 && parts[0] == "apps" && json.Unmarshal(body, spec) == nil && spec.AppName != "" {
+		return specAppID(spec)
+	}
+
+	return ""
+}
+
+// writeAuditRecord stores record, and appends it to auditLogPath when
+// set.
+func writeAuditRecord(record *types.AuditRecord) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.AddAuditRecord(record); err != nil {
+		return err
+	}
+
+	if auditLogPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// listAudit executes the "audit list" command.
+func listAudit(c *cli.Context) error {
+	p, err := newPrinter(c)
+	if err != nil {
+		return err
+	}
+
+	since, err := parseAuditTime(c.String("since"))
+	if err != nil {
+		return err
+	}
+
+	until, err := parseAuditTime(c.String("until"))
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	records, err := store.AuditRecords()
+	if err != nil {
+		return err
+	}
+
+	var matched []*types.AuditRecord
+	t := newOutputTable(
+		"ID",
+		"TIME",
+		"USER",
+		"CONTEXT",
+		"APP",
+		"REQUEST",
+		"STATUS",
+		"DURATION",
+	).wide(
+		"COMMAND",
+		"ERROR",
+	)
+	t.wrap = false
+	for _, record := range records {
+		switch {
+		case c.String("user") != "" && record.User != c.String("user"):
+			continue
+		case c.String("app") != "" && record.AppID != c.String("app"):
+			continue
+		case !since.IsZero() && record.Time.Before(since):
+			continue
+		case !until.IsZero() && record.Time.After(until):
+			continue
+		}
+
+		matched = append(matched, record)
+		t.append(
+			strconv.FormatUint(record.ID, 10),
+			record.Time.Local().Format("2006-01-02 15:04:05"),
+			record.User,
+			record.Context,
+			record.AppID,
+			record.Method+" "+record.Path,
+			auditStatus(record),
+			record.Duration.Round(time.Millisecond).String(),
+			record.Command,
+			record.Error,
+		)
+	}
+
+	return p.print(t, matched)
+}
+
+// showAudit executes the "audit show" command.
+func showAudit(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("audit record ID required")
+	}
+
+	id, err := strconv.ParseUint(c.Args()[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid audit record ID %q", c.Args()[0])
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	record, err := store.GetAuditRecord(id)
+	if err != nil {
+		return err
+	}
+
+	if record == nil {
+		return fmt.Errorf("audit record %d not found", id)
+	}
+
+	fmt.Printf("ID:        %d\n", record.ID)
+	fmt.Printf("Time:      %s\n", record.Time.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("User:      %s\n", record.User)
+	fmt.Printf("Command:   swancfg %s\n", record.Command)
+	fmt.Printf("Context:   %s (%s)\n", record.Context, record.Remote)
+	fmt.Printf("App:       %s\n", record.AppID)
+	fmt.Printf("Request:   %s %s\n", record.Method, record.Path)
+	fmt.Printf("Status:    %s\n", auditStatus(record))
+	fmt.Printf("Duration:  %s\n", record.Duration.Round(time.Millisecond))
+	if record.Error != "" {
+		fmt.Printf("Error:     %s\n", record.Error)
+	}
+
+	if len(record.Spec) > 0 {
+		var spec bytes.Buffer
+		if err := json.Indent(&spec, record.Spec, "", "  "); err != nil {
+			return fmt.Errorf("decode spec failed: %s", err.Error())
+		}
+		fmt.Printf("Spec:\n%s\n", spec.String())
+	}
+
+	return nil
+}
+
+func auditStatus(record *types.AuditRecord) string {
+	if record.Status == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(record.Status)
+}
+
+// parseAuditTime parses the --since and --until flags. A duration means
+// that long ago.
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected 2006-01-02, RFC3339 or a duration", s)
+}
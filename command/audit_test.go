@@ -0,0 +1,57 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestAuditCommandLine(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		NewContextCommand(),
+		NewUpdateCommand(),
+		NewDeleteCommand(),
+	}
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{
+			"update -f app.yml --set TOKEN=secret --set=PASSWORD=secret --wait 1m",
+			"update -f *** --set *** --set=*** --wait ***",
+		},
+		{
+			"context add --swan http://swan:9999 --password secret prod",
+			"context add --swan *** --password *** prod",
+		},
+		{
+			"delete --yes -l team=payments web-alice-test",
+			"delete --yes -l *** web-alice-test",
+		},
+		{
+			"delete --all",
+			"delete --all",
+		},
+		{
+			"delete --unknown secret web-alice-test",
+			"delete --unknown *** web-alice-test",
+		},
+		{
+			"delete --yes -- -web",
+			"delete --yes -- -web",
+		},
+		{
+			"unknown --password secret",
+			"unknown --password ***",
+		},
+	}
+
+	for _, test := range tests {
+		if got := auditCommandLine(app, strings.Fields(test.args)); got != test.want {
+			t.Errorf("auditCommandLine(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,657 @@
+package command
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// Files of a backup archive besides the spec files under apps/.
+const (
+	backupManifest = "manifest.json"
+	backupContexts = "contexts.json"
+	backupQuotas   = "quotas.json"
+	backupVersion  = 1
+)
+
+// Results of restoring an app besides the actions of apply.
+const (
+	restoreSkipped = "skipped"
+	restoreFailed  = "failed"
+)
+
+var restoreDone = map[string]string{
+	applyCreate: "created",
+	applyUpdate: "updated",
+	applyScale:  "scaled",
+}
+
+// NewBackupCommand returns the CLI command for "backup"
+func NewBackupCommand() cli.Command {
+	return cli.Command{
+		Name:  "backup",
+		Usage: "write the spec of every application, the contexts and quotas to an archive",
+		Description: "The archive is a tar.gz holding a spec file per app under apps/CLUSTER/,\n" +
+			"   contexts.json without passwords, quotas.json and a manifest.json with the\n" +
+			"   sha256 of every file.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "file, f",
+				Usage: "Write the archive to `FILE`, swancfg-backup-TIME.tar.gz by default",
+			},
+			cli.StringSliceFlag{
+				Name:  "cluster",
+				Usage: "Only back up the apps of `CLUSTER`, may be repeated",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := backupClusters(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// NewRestoreCommand returns the CLI command for "restore"
+func NewRestoreCommand() cli.Command {
+	return cli.Command{
+		Name:      "restore",
+		Usage:     "recreate the applications of a backup archive",
+		ArgsUsage: "[archive]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "Only restore the apps of user [USER]",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Only restore the apps of cluster [CLUSTER]",
+			},
+			cli.BoolFlag{
+				Name:  "overwrite",
+				Usage: "Update existing apps which differ from the backup, instead of skipping them",
+			},
+			cli.BoolFlag{
+				Name:  "config",
+				Usage: "Also restore missing contexts and quotas",
+			},
+			cli.BoolFlag{
+				Name:  "overwrite-quotas",
+				Usage: "Replace the quotas in the store with those of the backup, with --config",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print what would be restored without changing anything",
+			},
+			cli.BoolFlag{
+				Name:  "yes, y",
+				Usage: "Restore without asking for confirmation",
+			},
+			cli.BoolFlag{
+				Name:  "disable-quota",
+				Usage: "Disable quota check",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: time.Minute,
+				Usage: "Time to wait for each restored application",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := restoreBackup(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// backupFile is the content of a file of an archive.
+type backupFile struct {
+	path string
+	data []byte
+}
+
+// backupClusters executes the "backup" command.
+func backupClusters(c *cli.Context) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	contexts, err := store.ListClusters()
+	if err != nil {
+		store.Close()
+		return err
+	}
+
+	quotas, err := store.ListQuotas()
+	store.Close()
+	if err != nil {
+		return err
+	}
+
+	clusters := contexts
+	if names := c.StringSlice("cluster"); len(names) > 0 {
+		clusters = nil
+		for _, name := range names {
+			cluster := findContext(contexts, name)
+			if cluster == nil {
+				return fmt.Errorf("context %s not found", name)
+			}
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	if len(clusters) == 0 {
+		return fmt.Errorf("no context to back up, add one with: swancfg context add")
+	}
+
+	manifest := &types.BackupManifest{
+		Version: backupVersion,
+		Created: time.Now(),
+		Who:     whoami(),
+	}
+
+	var files []*backupFile
+	for _, cluster := range clusters {
+		if cluster.Swan == "" {
+			return fmt.Errorf("swan address of context %s not set", cluster.Name)
+		}
+
+		fmt.Printf("===> backing up cluster:%s...", cluster.Name)
+		apps, err := fetchApps(newClient(cluster), &appFilter{})
+		if err != nil {
+			fmt.Println("failed")
+			return fmt.Errorf("back up cluster %s failed, choose the clusters with --cluster: %s", cluster.Name, err.Error())
+		}
+		sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
+
+		backed := &types.BackupCluster{Name: cluster.Name, Swan: cluster.Swan}
+		var unknown []string
+		for _, app := range apps {
+			if app.CurrentVersion == nil {
+				unknown = append(unknown, app.ID)
+				continue
+			}
+
+			data, err := encodeSpec(liveSpec(app), formatYAML)
+			if err != nil {
+				return err
+			}
+
+			files = append(files, &backupFile{path: "apps/" + cluster.Name + "/" + app.ID + ".yaml", data: data})
+			backed.Apps++
+		}
+		manifest.Clusters = append(manifest.Clusters, backed)
+		fmt.Printf("%d apps\n", backed.Apps)
+
+		for _, id := range unknown {
+			fmt.Fprintf(os.Stderr, "Warning: current version of %s unknown, skipped\n", id)
+		}
+	}
+
+	// Passwords don't belong in an archive which is copied around.
+	var saved []*Cluster
+	for _, cluster := range contexts {
+		cl := *cluster
+		cl.Password = ""
+		saved = append(saved, &cl)
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append(files, &backupFile{path: backupContexts, data: data})
+
+	if data, err = json.MarshalIndent(quotas, "", "  "); err != nil {
+		return err
+	}
+	files = append(files, &backupFile{path: backupQuotas, data: data})
+
+	for _, f := range files {
+		sum := sha256.Sum256(f.data)
+		manifest.Files = append(manifest.Files, &types.BackupFile{
+			Path:   f.path,
+			Size:   int64(len(f.data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	path := c.String("file")
+	if path == "" {
+		path = fmt.Sprintf("swancfg-backup-%s.tar.gz", manifest.Created.Format("20060102-150405"))
+	}
+
+	if err := writeBackup(path, manifest, files); err != nil {
+		return err
+	}
+
+	fmt.Printf("===> backup of %d apps in %d cluster(s) written to %s\n", len(files)-2, len(clusters), path)
+	return nil
+}
+
+func findContext(contexts []*Cluster, name string) *Cluster {
+	for _, cluster := range contexts {
+		if cluster.Name == name {
+			return cluster
+		}
+	}
+
+	return nil
+}
+
+// writeBackup writes the archive to a temporary file first, so that an
+// existing archive at path is only replaced by a complete one.
+func writeBackup(path string, manifest *types.BackupManifest, files []*backupFile) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append([]*backupFile{{path: backupManifest, data: data}}, files...)
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create archive failed: %s", err.Error())
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.path,
+			Mode:    0600,
+			Size:    int64(len(file.data)),
+			ModTime: manifest.Created,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readBackup reads an archive and checks every file against the
+// manifest.
+func readBackup(path string) (*types.BackupManifest, map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read archive %s failed: %s", path, err.Error())
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read archive %s failed: %s", path, err.Error())
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s of archive failed: %s", header.Name, err.Error())
+		}
+		files[header.Name] = data
+	}
+
+	data, ok := files[backupManifest]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a swancfg backup, it has no %s", path, backupManifest)
+	}
+	delete(files, backupManifest)
+
+	var manifest *types.BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("decode %s failed: %s", backupManifest, err.Error())
+	}
+
+	if manifest.Version > backupVersion {
+		return nil, nil, fmt.Errorf("backup version %d is newer than %d, upgrade swancfg", manifest.Version, backupVersion)
+	}
+
+	listed := make(map[string]bool)
+	for _, file := range manifest.Files {
+		listed[file.Path] = true
+
+		data, ok := files[file.Path]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s missing from archive", file.Path)
+		}
+
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, nil, fmt.Errorf("checksum of %s mismatch, archive corrupted", file.Path)
+		}
+	}
+
+	for name := range files {
+		if !listed[name] {
+			return nil, nil, fmt.Errorf("%s of archive not in manifest", name)
+		}
+	}
+
+	return manifest, files, nil
+}
+
+// restoreBackup executes the "restore" command.
+func restoreBackup(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("Backup archive required")
+	}
+
+	manifest, files, err := readBackup(c.Args()[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("===> restoring backup of %s by %s\n", manifest.Created.Local().Format("2006-01-02 15:04:05"), manifest.Who)
+
+	user, cluster := c.String("user"), c.String("cluster")
+
+	config := &configRestore{}
+	if c.Bool("config") {
+		if config, err = planConfig(files, user, cluster, c.Bool("overwrite-quotas")); err != nil {
+			return err
+		}
+	}
+
+	var paths []string
+	for path := range files {
+		if strings.HasPrefix(path, "apps/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var steps []*applyStep
+	for _, path := range paths {
+		f := &specFile{Path: path}
+		if err := f.decode(files[path]); err != nil {
+			return err
+		}
+
+		spec, err := f.Spec()
+		if err != nil {
+			return fmt.Errorf("decode %s failed: %s", path, err.Error())
+		}
+
+		if (user != "" && spec.RunAs != user) || (cluster != "" && spec.Cluster != cluster) {
+			continue
+		}
+
+		steps = append(steps, &applyStep{AppId: specAppID(spec), Cluster: spec.Cluster, File: path, Spec: spec})
+	}
+
+	if len(steps) == 0 && config.empty() {
+		fmt.Println("No apps to restore")
+		return nil
+	}
+
+	// Clusters are compared one by one, so that one being down only fails
+	// its own apps. Those of contexts not restored yet are reached with
+	// the contexts of the backup.
+	plan := &applyPlan{clients: make(map[string]*client.Client)}
+	for _, saved := range config.contexts {
+		plan.clients[saved.Name] = newClient(saved)
+	}
+	results := make(map[*applyStep]string)
+	for _, group := range groupSteps(steps) {
+		sub := &applyPlan{Steps: group, clients: plan.clients}
+		err := sub.diff(false, nil)
+		for _, step := range group {
+			switch {
+			case err != nil:
+				results[step] = fmt.Sprintf("%s: %s", restoreFailed, err)
+			case step.Action == applyUnchanged:
+				results[step] = applyUnchanged
+			case step.App != nil && !c.Bool("overwrite"):
+				results[step] = restoreSkipped + ", app exists"
+			default:
+				plan.Steps = append(plan.Steps, step)
+			}
+		}
+	}
+
+	config.print()
+	if len(plan.Steps) > 0 {
+		printPlan(plan)
+	}
+
+	if (len(plan.Steps) > 0 || !config.empty()) && !c.Bool("dry-run") {
+		if !c.Bool("yes") && !confirm("Do you want to restore these apps?") {
+			return fmt.Errorf("restore cancelled")
+		}
+
+		if err := config.restore(); err != nil {
+			return err
+		}
+
+		for _, step := range plan.Steps {
+			if err := plan.apply(step, c.Bool("disable-quota"), c.Duration("wait")); err != nil {
+				results[step] = fmt.Sprintf("%s: %s", restoreFailed, err)
+				continue
+			}
+			results[step] = restoreDone[step.Action]
+		}
+	}
+
+	var failed int
+	t := newOutputTable(
+		"APP",
+		"CLUSTER",
+		"RESULT",
+	)
+	for _, step := range steps {
+		result, ok := results[step]
+		if !ok {
+			result = "would " + step.Action
+		}
+		if strings.HasPrefix(result, restoreFailed) {
+			failed++
+		}
+
+		t.append(step.AppId, step.Cluster, result)
+	}
+	t.render(os.Stdout, false, true)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d apps failed to restore", failed, len(steps))
+	}
+
+	return nil
+}
+
+// groupSteps splits steps by cluster, keeping their order.
+func groupSteps(steps []*applyStep) [][]*applyStep {
+	var (
+		groups [][]*applyStep
+		index  = make(map[string]int)
+	)
+	for _, step := range steps {
+		i, ok := index[step.Cluster]
+		if !ok {
+			i = len(groups)
+			index[step.Cluster] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], step)
+	}
+
+	return groups
+}
+
+// configRestore is what restore --config adds to the store.
+type configRestore struct {
+	contexts []*Cluster
+	quotas   []*types.QuotaChange
+}
+
+func (r *configRestore) empty() bool {
+	return len(r.contexts) == 0 && len(r.quotas) == 0
+}
+
+// planConfig finds the contexts and quotas of a backup missing from the
+// store, for user and cluster when set. Existing quotas are replaced when
+// overwriteQuotas is set, existing contexts never.
+func planConfig(files map[string][]byte, user, cluster string, overwriteQuotas bool) (*configRestore, error) {
+	var contexts []*Cluster
+	if data, ok := files[backupContexts]; ok {
+		if err := json.Unmarshal(data, &contexts); err != nil {
+			return nil, fmt.Errorf("decode %s failed: %s", backupContexts, err.Error())
+		}
+	}
+
+	var quotas Quota
+	if data, ok := files[backupQuotas]; ok {
+		if err := json.Unmarshal(data, &quotas); err != nil {
+			return nil, fmt.Errorf("decode %s failed: %s", backupQuotas, err.Error())
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	r := &configRestore{}
+	for _, saved := range contexts {
+		if cluster != "" && saved.Name != cluster {
+			continue
+		}
+
+		existing, err := store.GetCluster(saved.Name)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			r.contexts = append(r.contexts, saved)
+		}
+	}
+
+	for _, u := range quotas.users() {
+		if user != "" && u != user {
+			continue
+		}
+
+		for _, cl := range sortedKeys(quotas[u]) {
+			if cluster != "" && cl != cluster {
+				continue
+			}
+
+			existing, err := store.GetQuota(u, cl)
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil && (!overwriteQuotas || reflect.DeepEqual(existing, quotas[u][cl])) {
+				continue
+			}
+
+			r.quotas = append(r.quotas, newQuotaChange("restore", u, cl, quotas[u][cl]))
+		}
+	}
+
+	return r, nil
+}
+
+func (r *configRestore) print() {
+	for _, saved := range r.contexts {
+		fmt.Printf("===> context %s (%s) will be added\n", saved.Name, saved.Swan)
+	}
+
+	for _, change := range r.quotas {
+		fmt.Printf("===> quota of %s in %s will be restored\n", change.User, change.Cluster)
+	}
+}
+
+// restore writes the contexts and quotas to the store.
+func (r *configRestore) restore() error {
+	if r.empty() {
+		return nil
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, saved := range r.contexts {
+		if err := store.PutCluster(saved); err != nil {
+			return err
+		}
+	}
+
+	// Like with context add, the first context becomes the current one.
+	current, err := store.CurrentCluster()
+	if err != nil {
+		return err
+	}
+	if current == "" && len(r.contexts) > 0 {
+		clusters, err := store.ListClusters()
+		if err != nil {
+			return err
+		}
+		if err := store.UseCluster(clusters[0].Name); err != nil {
+			return err
+		}
+	}
+
+	if err := store.ChangeQuotas(r.quotas); err != nil {
+		return err
+	}
+
+	fmt.Printf("===> restored %d context(s) and %d quota(s)\n", len(r.contexts), len(r.quotas))
+	return nil
+}
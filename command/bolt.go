@@ -1,16 +1,37 @@
 package command
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/types"
 	"github.com/boltdb/bolt"
 )
 
+var (
+	clustersBucket     = []byte("clusters")
+	configBucket       = []byte("config")
+	quotasBucket       = []byte("quotas")
+	quotaHistoryBucket = []byte("quota-history")
+	usageBucket        = []byte("usage")
+	auditBucket        = []byte("audit")
+
+	currentClusterKey       = []byte("current-cluster")
+	legacyImportedKey       = []byte("legacy-imported")
+	legacyQuotasImportedKey = []byte("legacy-quotas-imported")
+)
+
 type BoltStore struct {
 	conn *bolt.DB
 	path string
 }
 
 func NewBoltStore(path string) (*BoltStore, error) {
-	handle, err := bolt.Open(path, 0600, nil)
+	// Don't wait forever when another swancfg holds the database.
+	handle, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
 		return nil, err
 	}
@@ -36,8 +57,10 @@ func (b *BoltStore) initialize() error {
 	defer tx.Rollback()
 
 	// Create all the buckets
-	if _, err := tx.CreateBucketIfNotExists([]byte("swan")); err != nil {
-		return err
+	for _, name := range [][]byte{clustersBucket, configBucket, quotasBucket, quotaHistoryBucket, usageBucket, auditBucket} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -46,3 +69,368 @@ func (b *BoltStore) initialize() error {
 func (b *BoltStore) Close() error {
 	return b.conn.Close()
 }
+
+// GetCluster returns the named cluster context, or nil if there is none.
+func (b *BoltStore) GetCluster(name string) (*Cluster, error) {
+	var cluster *Cluster
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(clustersBucket).Get([]byte(name))
+		if val == nil {
+			return nil
+		}
+
+		return json.Unmarshal(val, &cluster)
+	})
+
+	return cluster, err
+}
+
+// ListClusters returns every cluster context ordered by name.
+func (b *BoltStore) ListClusters() ([]*Cluster, error) {
+	var clusters []*Cluster
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(clustersBucket).ForEach(func(k, v []byte) error {
+			var cluster *Cluster
+			if err := json.Unmarshal(v, &cluster); err != nil {
+				return fmt.Errorf("decode cluster %s failed: %s", k, err.Error())
+			}
+			clusters = append(clusters, cluster)
+			return nil
+		})
+	})
+
+	return clusters, err
+}
+
+// PutCluster creates or replaces a cluster context.
+func (b *BoltStore) PutCluster(cluster *Cluster) error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		return putCluster(tx, cluster)
+	})
+}
+
+// RemoveCluster deletes a cluster context and clears it as the current
+// one if needed.
+func (b *BoltStore) RemoveCluster(name string) error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(clustersBucket)
+		if bucket.Get([]byte(name)) == nil {
+			return fmt.Errorf("context %s not found", name)
+		}
+
+		if err := bucket.Delete([]byte(name)); err != nil {
+			return err
+		}
+
+		config := tx.Bucket(configBucket)
+		if string(config.Get(currentClusterKey)) == name {
+			return config.Delete(currentClusterKey)
+		}
+
+		return nil
+	})
+}
+
+// RenameCluster renames a cluster context, following it with the current
+// context pointer.
+func (b *BoltStore) RenameCluster(from, to string) error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(clustersBucket)
+		val := bucket.Get([]byte(from))
+		if val == nil {
+			return fmt.Errorf("context %s not found", from)
+		}
+
+		if bucket.Get([]byte(to)) != nil {
+			return fmt.Errorf("context %s already exists", to)
+		}
+
+		var cluster *Cluster
+		if err := json.Unmarshal(val, &cluster); err != nil {
+			return err
+		}
+		cluster.Name = to
+
+		if err := putCluster(tx, cluster); err != nil {
+			return err
+		}
+
+		if err := bucket.Delete([]byte(from)); err != nil {
+			return err
+		}
+
+		config := tx.Bucket(configBucket)
+		if string(config.Get(currentClusterKey)) == from {
+			return config.Put(currentClusterKey, []byte(to))
+		}
+
+		return nil
+	})
+}
+
+// CurrentCluster returns the name of the context in use.
+func (b *BoltStore) CurrentCluster() (string, error) {
+	var name string
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		name = string(tx.Bucket(configBucket).Get(currentClusterKey))
+		return nil
+	})
+
+	return name, err
+}
+
+// UseCluster switches the context in use.
+func (b *BoltStore) UseCluster(name string) error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(clustersBucket).Get([]byte(name)) == nil {
+			return fmt.Errorf("context %s not found", name)
+		}
+
+		return tx.Bucket(configBucket).Put(currentClusterKey, []byte(name))
+	})
+}
+
+// LegacyImported reports whether cluster.cfg and the old swan bucket have
+// already been imported.
+func (b *BoltStore) LegacyImported() (bool, error) {
+	var imported bool
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		imported = tx.Bucket(configBucket).Get(legacyImportedKey) != nil
+		return nil
+	})
+
+	return imported, err
+}
+
+// MarkLegacyImported records that the legacy import ran.
+func (b *BoltStore) MarkLegacyImported() error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(configBucket).Put(legacyImportedKey, []byte(time.Now().Format(time.RFC3339)))
+	})
+}
+
+// LegacyQuotasImported reports whether quota.yml has already been
+// imported.
+func (b *BoltStore) LegacyQuotasImported() (bool, error) {
+	var imported bool
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		imported = tx.Bucket(configBucket).Get(legacyQuotasImportedKey) != nil
+		return nil
+	})
+
+	return imported, err
+}
+
+// MarkLegacyQuotasImported records that the quota.yml import ran.
+func (b *BoltStore) MarkLegacyQuotasImported() error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(configBucket).Put(legacyQuotasImportedKey, []byte(time.Now().Format(time.RFC3339)))
+	})
+}
+
+// GetQuota returns the quota of user in cluster, or nil if there is none.
+func (b *BoltStore) GetQuota(user, cluster string) (*types.Quota, error) {
+	var quota *types.Quota
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(quotasBucket).Get(quotaKey(user, cluster))
+		if val == nil {
+			return nil
+		}
+
+		return json.Unmarshal(val, &quota)
+	})
+
+	return quota, err
+}
+
+// ListQuotas returns every quota by user and cluster.
+func (b *BoltStore) ListQuotas() (Quota, error) {
+	quotas := make(Quota)
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(quotasBucket).ForEach(func(k, v []byte) error {
+			parts := strings.SplitN(string(k), "/", 2)
+			if len(parts) != 2 {
+				return nil
+			}
+
+			var quota *types.Quota
+			if err := json.Unmarshal(v, &quota); err != nil {
+				return fmt.Errorf("decode quota %s failed: %s", k, err.Error())
+			}
+
+			if quotas[parts[0]] == nil {
+				quotas[parts[0]] = make(map[string]*types.Quota)
+			}
+			quotas[parts[0]][parts[1]] = quota
+			return nil
+		})
+	})
+
+	return quotas, err
+}
+
+// ChangeQuotas applies changes in a single transaction and appends them
+// to the quota history. A change without After removes the quota. Before
+// is filled in from the store.
+func (b *BoltStore) ChangeQuotas(changes []*types.QuotaChange) error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		bucket, history := tx.Bucket(quotasBucket), tx.Bucket(quotaHistoryBucket)
+		for _, change := range changes {
+			key := quotaKey(change.User, change.Cluster)
+
+			change.Before = nil
+			if val := bucket.Get(key); val != nil {
+				if err := json.Unmarshal(val, &change.Before); err != nil {
+					return err
+				}
+			}
+
+			if change.After == nil {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			} else {
+				data, err := json.Marshal(change.After)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put(key, data); err != nil {
+					return err
+				}
+			}
+
+			seq, err := history.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(change)
+			if err != nil {
+				return err
+			}
+
+			id := make([]byte, 8)
+			binary.BigEndian.PutUint64(id, seq)
+			if err := history.Put(id, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// QuotaHistory returns every recorded quota change, oldest first.
+func (b *BoltStore) QuotaHistory() ([]*types.QuotaChange, error) {
+	var changes []*types.QuotaChange
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(quotaHistoryBucket).ForEach(func(k, v []byte) error {
+			var change *types.QuotaChange
+			if err := json.Unmarshal(v, &change); err != nil {
+				return fmt.Errorf("decode quota change %d failed: %s", binary.BigEndian.Uint64(k), err.Error())
+			}
+			changes = append(changes, change)
+			return nil
+		})
+	})
+
+	return changes, err
+}
+
+// AddAuditRecord appends record to the audit log, setting its ID.
+func (b *BoltStore) AddAuditRecord(record *types.AuditRecord) error {
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(auditBucket)
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		record.ID = seq
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		id := make([]byte, 8)
+		binary.BigEndian.PutUint64(id, seq)
+		return bucket.Put(id, data)
+	})
+}
+
+// AuditRecords returns every audit record, oldest first.
+func (b *BoltStore) AuditRecords() ([]*types.AuditRecord, error) {
+	var records []*types.AuditRecord
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).ForEach(func(k, v []byte) error {
+			var record *types.AuditRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("decode audit record %d failed: %s", binary.BigEndian.Uint64(k), err.Error())
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+// GetAuditRecord returns the audit record with id, or nil if there is
+// none.
+func (b *BoltStore) GetAuditRecord(id uint64) (*types.AuditRecord, error) {
+	var record *types.AuditRecord
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, id)
+
+		val := tx.Bucket(auditBucket).Get(key)
+		if val == nil {
+			return nil
+		}
+
+		return json.Unmarshal(val, &record)
+	})
+
+	return record, err
+}
+
+// GetUsage returns the cached usage of cluster, or nil if there is none.
+func (b *BoltStore) GetUsage(cluster string) (*clusterUsage, error) {
+	var used *clusterUsage
+	err := b.conn.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(usageBucket).Get([]byte(cluster))
+		if val == nil {
+			return nil
+		}
+
+		return json.Unmarshal(val, &used)
+	})
+
+	return used, err
+}
+
+// PutUsage caches the usage of cluster.
+func (b *BoltStore) PutUsage(cluster string, used *clusterUsage) error {
+	data, err := json.Marshal(used)
+	if err != nil {
+		return err
+	}
+
+	return b.conn.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(usageBucket).Put([]byte(cluster), data)
+	})
+}
+
+func quotaKey(user, cluster string) []byte {
+	return []byte(user + "/" + cluster)
+}
+
+func putCluster(tx *bolt.Tx, cluster *Cluster) error {
+	data, err := json.Marshal(cluster)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(clustersBucket).Put([]byte(cluster.Name), data)
+}
@@ -0,0 +1,485 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/urfave/cli"
+)
+
+const (
+	legacyClusterFile = "cluster.cfg"
+	legacyStoreFile   = ".bolt.db"
+	legacyCluster     = "default"
+)
+
+// Cluster is a named context: the swan and mesos endpoints of one cluster
+// plus the credentials and default user to talk to it with. Its name is
+// the cluster part of app ids.
+type Cluster struct {
+	Name     string `json:"name"`
+	Swan     string `json:"swan"`
+	Mesos    string `json:"mesos,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	User     string `json:"user,omitempty"`
+}
+
+func NewContextCommand() cli.Command {
+	return cli.Command{
+		Name:  "context",
+		Usage: "cluster context management",
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name:      "add",
+				Usage:     "add or update a context",
+				ArgsUsage: "[name]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "swan",
+						Usage: "Swan address of the cluster",
+					},
+					cli.StringFlag{
+						Name:  "mesos",
+						Usage: "Mesos master address of the cluster",
+					},
+					cli.StringFlag{
+						Name:  "username",
+						Usage: "Username for swan basic auth",
+					},
+					cli.StringFlag{
+						Name:  "password",
+						Usage: "Password for swan basic auth",
+					},
+					cli.StringFlag{
+						Name:  "user",
+						Usage: "Default user applications run as",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if err := addContext(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:      "use",
+				Usage:     "switch the current context",
+				ArgsUsage: "[name]",
+				Action: func(c *cli.Context) {
+					if err := useContext(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:  "list",
+				Usage: "list contexts",
+				Flags: outputFlags(),
+				Action: func(c *cli.Context) {
+					if err := listContexts(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:      "remove",
+				Usage:     "remove a context",
+				ArgsUsage: "[name]",
+				Action: func(c *cli.Context) {
+					if err := removeContext(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:      "rename",
+				Usage:     "rename a context",
+				ArgsUsage: "[old] [new]",
+				Action: func(c *cli.Context) {
+					if err := renameContext(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:  "import",
+				Usage: "import cluster.cfg and .bolt.db from the current directory",
+				Action: func(c *cli.Context) {
+					if err := importContexts(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func addContext(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("context name required")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	name := c.Args()[0]
+	cluster, err := store.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	if cluster == nil {
+		if c.String("swan") == "" {
+			return fmt.Errorf("swan address required for new context %s", name)
+		}
+		cluster = &Cluster{Name: name}
+	}
+
+	if c.IsSet("swan") {
+		cluster.Swan = c.String("swan")
+	}
+	if c.IsSet("mesos") {
+		cluster.Mesos = c.String("mesos")
+	}
+	if c.IsSet("username") {
+		cluster.Username = c.String("username")
+	}
+	if c.IsSet("password") {
+		cluster.Password = c.String("password")
+	}
+	if c.IsSet("user") {
+		cluster.User = c.String("user")
+	}
+
+	if err := store.PutCluster(cluster); err != nil {
+		return err
+	}
+
+	// The first context becomes the current one.
+	current, err := store.CurrentCluster()
+	if err != nil {
+		return err
+	}
+
+	if current == "" {
+		return store.UseCluster(name)
+	}
+
+	return nil
+}
+
+func useContext(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("context name required")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.UseCluster(c.Args()[0]); err != nil {
+		return err
+	}
+
+	fmt.Printf("Switched to context %s\n", c.Args()[0])
+
+	return nil
+}
+
+// contextItem is a context as listed, without its password.
+type contextItem struct {
+	Name     string `json:"name"`
+	Current  bool   `json:"current"`
+	Swan     string `json:"swan"`
+	Mesos    string `json:"mesos,omitempty"`
+	Username string `json:"username,omitempty"`
+	User     string `json:"user,omitempty"`
+}
+
+func listContexts(c *cli.Context) error {
+	p, err := newPrinter(c)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	clusters, err := store.ListClusters()
+	if err != nil {
+		return err
+	}
+
+	current, err := store.CurrentCluster()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+
+	var items []*contextItem
+	t := newOutputTable(
+		"CURRENT",
+		"NAME",
+		"SWAN",
+		"MESOS",
+		"USER",
+	).wide(
+		"USERNAME",
+	)
+	for _, cluster := range clusters {
+		mark := ""
+		if cluster.Name == current {
+			mark = "*"
+		}
+		t.append(
+			mark,
+			cluster.Name,
+			cluster.Swan,
+			cluster.Mesos,
+			cluster.User,
+			cluster.Username,
+		)
+		items = append(items, &contextItem{
+			Name:     cluster.Name,
+			Current:  cluster.Name == current,
+			Swan:     cluster.Swan,
+			Mesos:    cluster.Mesos,
+			Username: cluster.Username,
+			User:     cluster.User,
+		})
+	}
+
+	return p.print(t, items)
+}
+
+func removeContext(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("context name required")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.RemoveCluster(c.Args()[0])
+}
+
+func renameContext(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return fmt.Errorf("old and new context names required")
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.RenameCluster(c.Args()[0], c.Args()[1])
+}
+
+func importContexts(c *cli.Context) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	n, err := importLegacyClusters(store, ".")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d context(s)\n", n)
+
+	return nil
+}
+
+// importLegacyClusters copies the clusters of cluster.cfg and the swan and
+// mesos remotes of the old .bolt.db found in dir into store. Remotes that
+// match a cluster.cfg address are merged into that cluster, otherwise they
+// become the "default" context. Existing contexts are left untouched.
+func importLegacyClusters(store *BoltStore, dir string) (int, error) {
+	clusters, err := readClusterCfg(filepath.Join(dir, legacyClusterFile))
+	if err != nil {
+		return 0, err
+	}
+
+	remotes, err := readLegacyRemotes(filepath.Join(dir, legacyStoreFile), store.path)
+	if err != nil {
+		return 0, err
+	}
+
+	var current string
+	if swan := remotes["swan"]; swan != "" {
+		for _, cluster := range clusters {
+			if cluster.Swan == swan {
+				current = cluster.Name
+				cluster.Mesos = remotes["mesos"]
+			}
+		}
+
+		if current == "" {
+			current = legacyCluster
+			clusters = append(clusters, &Cluster{
+				Name:  legacyCluster,
+				Swan:  swan,
+				Mesos: remotes["mesos"],
+			})
+		}
+	}
+
+	var imported int
+	for _, cluster := range clusters {
+		existing, err := store.GetCluster(cluster.Name)
+		if err != nil {
+			return imported, err
+		}
+
+		if existing != nil {
+			continue
+		}
+
+		if err := store.PutCluster(cluster); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+
+	if len(clusters) > 0 {
+		if current == "" {
+			current = clusters[0].Name
+		}
+
+		name, err := store.CurrentCluster()
+		if err != nil {
+			return imported, err
+		}
+
+		if name == "" {
+			if err := store.UseCluster(current); err != nil {
+				return imported, err
+			}
+		}
+	}
+
+	return imported, nil
+}
+
+// importLegacyOnce imports cluster.cfg and .bolt.db from the current
+// directory until it finds any, or the store holds contexts of its own.
+// swancfg may first run elsewhere than the old files, they are imported
+// by the first command run next to them.
+func importLegacyOnce(store *BoltStore) error {
+	imported, err := store.LegacyImported()
+	if err != nil || imported {
+		return err
+	}
+
+	n, err := importLegacyClusters(store, ".")
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		clusters, err := store.ListClusters()
+		if err != nil || len(clusters) == 0 {
+			return err
+		}
+		return store.MarkLegacyImported()
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d context(s) from %s and %s\n", n, legacyClusterFile, legacyStoreFile)
+	fmt.Fprintln(os.Stderr, "Legacy files of other directories are imported with: swancfg context import")
+
+	return store.MarkLegacyImported()
+}
+
+// readClusterCfg parses the "name\t\taddress" lines of cluster.cfg. A
+// missing file yields no clusters.
+func readClusterCfg(path string) ([]*Cluster, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var clusters []*Cluster
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) < 2 || strings.HasPrefix(line[0], "#") {
+			continue
+		}
+
+		clusters = append(clusters, &Cluster{
+			Name: line[0],
+			Swan: line[1],
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s failed: %s", path, err.Error())
+	}
+
+	return clusters, nil
+}
+
+// readLegacyRemotes returns the swan bucket of the old .bolt.db. A missing
+// file yields no remotes.
+func readLegacyRemotes(path, storePath string) (map[string]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		if store, err := filepath.Abs(storePath); err == nil && abs == store {
+			return nil, nil
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s failed: %s", path, err.Error())
+	}
+	defer db.Close()
+
+	remotes := make(map[string]string)
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("swan"))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			remotes[string(k)] = string(v)
+			return nil
+		})
+	})
+
+	return remotes, err
+}
@@ -1,10 +1,12 @@
 package command
 
 import (
+	"context"
 	"fmt"
-	"github.com/urfave/cli"
-	"net/http"
 	"os"
+	"strings"
+
+	"github.com/urfave/cli"
 )
 
 // NewDeleteCommand returns the CLI command for "delete"
@@ -13,7 +15,7 @@ func NewDeleteCommand() cli.Command {
 		Name:      "delete",
 		Usage:     "delete application",
 		ArgsUsage: "[name]",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "user",
 				Usage: "Delete apps belong to user [USER]",
@@ -24,9 +26,13 @@ func NewDeleteCommand() cli.Command {
 			},
 			cli.BoolFlag{
 				Name:  "all",
-				Usage: "Delete all apps",
+				Usage: "Delete all apps, or all the selected apps without asking for confirmation",
 			},
-		},
+			cli.BoolFlag{
+				Name:  "yes, y",
+				Usage: "Delete the selected apps without asking for confirmation",
+			},
+		}, selectorFlags()...),
 		Action: func(c *cli.Context) error {
 			if err := deleteApp(c); err != nil {
 				fmt.Fprintln(os.Stderr, "Error:", err)
@@ -38,49 +44,69 @@ func NewDeleteCommand() cli.Command {
 
 // deleteApplication executes the "delete" command.
 func deleteApp(c *cli.Context) error {
-	if c.Bool("all") {
-		return deleteAll(c)
+	for _, name := range []string{"selector", "field-selector", "user"} {
+		if c.IsSet(name) && strings.TrimSpace(c.String(name)) == "" {
+			return fmt.Errorf("--%s can't be empty", name)
+		}
 	}
 
-	if len(c.Args()) == 0 {
-		return fmt.Errorf("name required")
+	filter, err := newAppFilter(c)
+	if err != nil {
+		return err
 	}
+	filter.withField("runAs", c.String("user"))
 
-	if c.String("cluster") == "" {
-		return fmt.Errorf("cluster required")
+	if len(c.Args()) == 0 {
+		if !c.Bool("all") && filter.empty() {
+			return fmt.Errorf("name, selector or --all required")
+		}
+		return deleteAll(c, filter)
 	}
 
-	swan, err := getRemote("swan")
+	swan, err := appClient(c.Args()[0], c.String("cluster"))
 	if err != nil {
 		return err
 	}
 
-	if swan == "" {
-		return fmt.Errorf("swan address not found")
-	}
+	return swan.DeleteApp(context.Background(), c.Args()[0])
+}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/apps/%s", swan, c.Args()[0]), nil)
+// deleteAll deletes the apps of the cluster filter selects, every app
+// with --all alone. More than one app is only deleted with --all or once
+// confirmed.
+func deleteAll(c *cli.Context, filter *appFilter) error {
+	swan, err := clusterClient(c.String("cluster"))
 	if err != nil {
-		return fmt.Errorf("Make new request failed: %s", err.Error())
+		return err
 	}
 
-	_, err = client.Do(req)
+	ctx := context.Background()
+	apps, err := selectApps(ctx, swan, filter)
+	if err != nil {
+		return err
+	}
 
-	return err
-}
+	if len(apps) == 0 {
+		fmt.Println("No apps selected")
+		return nil
+	}
 
-func deleteAll(c *cli.Context) error {
-	apps, _ := getAllApps("")
+	if len(apps) > 1 && !c.Bool("all") && !c.Bool("yes") {
+		for _, app := range apps {
+			fmt.Println(app.ID)
+		}
+		if !confirm(fmt.Sprintf("Do you want to delete these %d apps?", len(apps))) {
+			return fmt.Errorf("delete cancelled")
+		}
+	}
 
 	for _, app := range apps {
-		client := &http.Client{}
-		swanAddr, _ := getRemote("swan")
-		req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/apps/%s", swanAddr, app.ID), nil)
 		fmt.Printf("Deleting %s\t", app.ID)
-		client.Do(req)
+		if err := swan.DeleteApp(ctx, app.ID); err != nil {
+			fmt.Printf("failed: %s\n", err.Error())
+			continue
+		}
 		fmt.Printf("done\n")
-
 	}
 
 	return nil
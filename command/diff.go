@@ -0,0 +1,391 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// diffContext is the number of unchanged lines around each hunk.
+const diffContext = 3
+
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+	colorBold  = "\x1b[1m"
+)
+
+// NewDiffCommand returns the CLI command for "diff"
+func NewDiffCommand() cli.Command {
+	return cli.Command{
+		Name:  "diff",
+		Usage: "show differences between a spec file and the deployed application",
+		Description: "Exits with 0 when the spec matches the deployed version, 1 when they\n" +
+			"   differ and 2 on error.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "from-file, f",
+				Usage: "Compare application spec in `FILE`, - for stdin",
+			},
+			cli.StringFlag{
+				Name:  "name, n",
+				Usage: "Set application name",
+			},
+			cli.BoolFlag{
+				Name:  "no-color",
+				Usage: "Don't colorize the diff",
+			},
+		}, templateFlags()...),
+		Action: func(c *cli.Context) error {
+			differ, err := diffSpec(c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 2)
+			}
+			if differ {
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// diffSpec executes the "diff" command and reports whether the spec
+// differs from the deployed version.
+func diffSpec(c *cli.Context) (bool, error) {
+	if c.String("from-file") == "" {
+		return false, fmt.Errorf("Spec file must be specified for diffing application")
+	}
+
+	vars, err := specVars(c)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := readValidSpec(c.String("from-file"), vars)
+	if err != nil {
+		return false, err
+	}
+
+	spec, err := f.Spec()
+	if err != nil {
+		return false, err
+	}
+
+	if name := c.String("name"); name != "" {
+		spec.AppName = name
+	}
+
+	if err := completeSpec(spec); err != nil {
+		return false, err
+	}
+
+	swan, err := clusterClient(spec.Cluster)
+	if err != nil {
+		return false, err
+	}
+
+	appId := specAppID(spec)
+	live := &types.Spec{}
+	app, err := swan.GetApp(context.Background(), appId)
+	if err != nil {
+		if !client.IsNotFound(err) {
+			return false, err
+		}
+		app = nil
+	} else {
+		live = liveSpec(app)
+	}
+
+	from, to, err := normalizeSpecs(live, spec, f.Doc)
+	if err != nil {
+		return false, err
+	}
+
+	fromName := "live/" + appId
+	if app == nil {
+		// The app isn't deployed yet, the whole spec is new.
+		from, fromName = nil, "/dev/null"
+	}
+
+	lines := unifiedDiff(from, to, fromName, c.String("from-file"))
+	if len(lines) == 0 {
+		return false, nil
+	}
+
+	printDiff(os.Stdout, lines, !c.Bool("no-color") && isTerminal(os.Stdout))
+
+	return true, nil
+}
+
+// normalizeSpecs renders both specs as sorted yaml lines. Fields missing
+// from set, the spec file document, are filled by swan, so they are taken
+// from live, as is the label apply marks the apps it manages with. A nil
+// set takes nothing from live.
+func normalizeSpecs(live, desired *types.Spec, set interface{}) ([]string, []string, error) {
+	liveDoc, err := specDoc(live)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desiredDoc, err := specDoc(desired)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desiredDoc = inheritDoc(liveDoc, desiredDoc, set)
+	if l, ok := liveDoc.(map[string]interface{}); ok {
+		if d, ok := desiredDoc.(map[string]interface{}); ok {
+			labels, _ := l["Labels"].(map[string]interface{})
+			desiredLabels, _ := d["Labels"].(map[string]interface{})
+			if _, ok := labels[managedByLabel]; ok && desiredLabels != nil {
+				if _, ok := desiredLabels[managedByLabel]; !ok {
+					desiredLabels[managedByLabel] = labels[managedByLabel]
+				}
+			}
+		}
+	}
+
+	from, err := yamlLines(plainDoc("", liveDoc))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to, err := yamlLines(plainDoc("", desiredDoc))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return from, to, nil
+}
+
+// inheritDoc returns desired with the fields missing from set taken from
+// live. Labels and env are taken whole or not at all.
+func inheritDoc(live, desired, set interface{}) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return desired
+		}
+
+		for key, val := range d {
+			lv, lok := l[key]
+			below, ok := setField(set, key)
+			switch {
+			case !ok && lok:
+				d[key] = lv
+			case ok && lok && key != "Labels" && key != "Env":
+				d[key] = inheritDoc(lv, val, below)
+			}
+		}
+		return d
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return desired
+		}
+
+		for i := range d {
+			d[i] = inheritDoc(l[i], d[i], setItem(set, i))
+		}
+		return d
+	}
+
+	return desired
+}
+
+// plainDoc converts a spec document for printing: field names in
+// lowerCamel case and numbers as numbers.
+func plainDoc(path string, val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name := key
+			if path != "Labels" && path != "Env" {
+				name = strings.ToLower(key[:1]) + key[1:]
+			}
+			m[name] = plainDoc(key, item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = plainDoc(path, item)
+		}
+		return list
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+
+	return val
+}
+
+func yamlLines(doc interface{}) ([]string, error) {
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// unifiedDiff returns the lines of the unified diff turning a into b, or
+// nothing when they are equal.
+func unifiedDiff(a, b []string, fromName, toName string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// ops holds one entry per line of the edit script: ' ', '-' or '+'.
+	type op struct {
+		kind byte
+		line string
+		i, j int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var lines []string
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		end, unchanged := first, 0
+		for k := first; k < len(ops); k++ {
+			if ops[k].kind == ' ' {
+				unchanged++
+				if unchanged > 2*diffContext {
+					break
+				}
+				continue
+			}
+			unchanged = 0
+			end = k + 1
+		}
+
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := end + diffContext
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		var aLen, bLen int
+		for _, o := range ops[from:to] {
+			if o.kind != '+' {
+				aLen++
+			}
+			if o.kind != '-' {
+				bLen++
+			}
+		}
+
+		if len(lines) == 0 {
+			lines = append(lines, "--- "+fromName, "+++ "+toName)
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@", hunkRange(ops[from].i, aLen), hunkRange(ops[from].j, bLen)))
+		for _, o := range ops[from:to] {
+			lines = append(lines, string(o.kind)+o.line)
+		}
+
+		start = to
+	}
+
+	return lines
+}
+
+// hunkRange formats the range of a hunk as diff(1) does.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func printDiff(w io.Writer, lines []string, color bool) {
+	for _, line := range lines {
+		if !color {
+			fmt.Fprintln(w, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			fmt.Fprintln(w, colorBold+line+colorReset)
+		case strings.HasPrefix(line, "@@"):
+			fmt.Fprintln(w, colorCyan+line+colorReset)
+		case strings.HasPrefix(line, "-"):
+			fmt.Fprintln(w, colorRed+line+colorReset)
+		case strings.HasPrefix(line, "+"):
+			fmt.Fprintln(w, colorGreen+line+colorReset)
+		default:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,376 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+const eventFormat = "%-19s  %-17s  %-30s  %-34s  %-20s  %-7s  %s\n"
+
+// NewEventsCommand returns the CLI command for "events"
+func NewEventsCommand() cli.Command {
+	return cli.Command{
+		Name:  "events",
+		Usage: "watch events of the cluster",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "app",
+				Usage: "Only watch events of app [APP]",
+			},
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "Only watch events of apps belong to user [USER]",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Watch events of cluster [CLUSTER]",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Value: formatTable,
+				Usage: "Output format: table, or json for one event per line",
+			},
+			cli.BoolFlag{
+				Name:  "no-headers",
+				Usage: "Don't print the table headers, for scripting",
+			},
+			cli.BoolFlag{
+				Name:  "poll",
+				Usage: "Diff app snapshots instead of subscribing to the event stream",
+			},
+			cli.DurationFlag{
+				Name:  "interval",
+				Value: 2 * time.Second,
+				Usage: "Time between two app snapshots when polling",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := watchEvents(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			return nil
+		},
+	}
+}
+
+// eventFilter selects the events of one app and/or one user.
+type eventFilter struct {
+	app  string
+	user string
+}
+
+func (f *eventFilter) match(e *types.Event) bool {
+	if f.app != "" && e.AppId != f.app {
+		return false
+	}
+
+	return f.user == "" || e.RunAs == f.user
+}
+
+// watchEvents executes the "events" command.
+func watchEvents(c *cli.Context) error {
+	filter := &eventFilter{
+		app:  c.String("app"),
+		user: c.String("user"),
+	}
+
+	format := c.String("output")
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("unknown output %q, expected table or json", format)
+	}
+
+	var (
+		swan *client.Client
+		err  error
+	)
+	if filter.app != "" {
+		swan, err = appClient(filter.app, c.String("cluster"))
+	} else {
+		swan, err = clusterClient(c.String("cluster"))
+	}
+	if err != nil {
+		return err
+	}
+
+	printEvent := printEventTable
+	if format == formatJSON {
+		printEvent = printEventJSON
+	} else if !c.Bool("no-headers") {
+		fmt.Printf(eventFormat, "TIME", "TYPE", "APP", "TASK", "STATE", "HEALTHY", "REASON")
+	}
+
+	emit := func(e *types.Event) {
+		if filter.match(e) {
+			printEvent(os.Stdout, e)
+		}
+	}
+
+	if !c.Bool("poll") {
+		err := streamEvents(swan, filter, emit)
+		if err == nil || !client.IsUnsupported(err) {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Event stream not served by swan, watching app snapshots instead")
+	}
+
+	return pollEvents(swan, filter, c.Duration("interval"), emit)
+}
+
+// streamEvents prints the events swan publishes until the stream ends.
+func streamEvents(swan *client.Client, filter *eventFilter, emit func(*types.Event)) error {
+	stream, err := swan.Events(context.Background(), filter.app)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for {
+		e, err := stream.Next()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("event stream closed by swan")
+			}
+			return err
+		}
+
+		classifyEvent(e)
+		if e.RunAs == "" {
+			e.RunAs = appUser(e.AppId)
+		}
+		emit(e)
+	}
+}
+
+// classifyEvent maps the name of a swan event onto one of our event
+// types. Swan names task events after their mesos state, so the type is
+// derived from the state when the name isn't one of ours.
+func classifyEvent(e *types.Event) {
+	switch e.Type {
+	case types.EventAppCreated, types.EventAppDeleted, types.EventAppStateChanged,
+		types.EventTaskStarted, types.EventTaskFailed, types.EventTaskStateChanged,
+		types.EventTaskRemoved, types.EventHealthChanged:
+		return
+	}
+
+	switch {
+	case strings.Contains(strings.ToLower(e.Type), "health"):
+		e.Type = types.EventHealthChanged
+	case e.TaskId != "" && taskFailed(e.State):
+		e.Type = types.EventTaskFailed
+	case e.TaskId != "" && strings.HasSuffix(strings.ToLower(e.State), "running"):
+		e.Type = types.EventTaskStarted
+	case e.TaskId != "":
+		e.Type = types.EventTaskStateChanged
+	case e.State != "":
+		e.Type = types.EventAppStateChanged
+	}
+}
+
+// pollEvents takes a snapshot of the apps every interval and prints what
+// changed since the previous one.
+func pollEvents(swan *client.Client, filter *eventFilter, interval time.Duration, emit func(*types.Event)) error {
+	var prev map[string]*types.App
+	for {
+		cur, err := snapshotApps(swan, filter)
+		if err != nil {
+			return err
+		}
+
+		if prev != nil {
+			for _, e := range diffApps(prev, cur, time.Now()) {
+				emit(e)
+			}
+		}
+		prev = cur
+
+		time.Sleep(interval)
+	}
+}
+
+// snapshotApps returns the apps selected by filter, with their tasks.
+func snapshotApps(swan *client.Client, filter *eventFilter) (map[string]*types.App, error) {
+	ctx := context.Background()
+	apps := make(map[string]*types.App)
+
+	if filter.app != "" {
+		app, err := swan.GetApp(ctx, filter.app)
+		if err != nil {
+			if client.IsNotFound(err) {
+				return apps, nil
+			}
+			return nil, err
+		}
+		apps[app.ID] = app
+		return apps, nil
+	}
+
+	opts := &client.ListOptions{}
+	if filter.user != "" {
+		opts.Fields = []string{fmt.Sprintf("runAs==%s", filter.user)}
+	}
+
+	list, err := swan.ListApps(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, app := range list {
+		detail, err := swan.GetApp(ctx, app.ID)
+		if err != nil {
+			if client.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		apps[detail.ID] = detail
+	}
+
+	return apps, nil
+}
+
+// diffApps derives the events that turn prev into cur.
+func diffApps(prev, cur map[string]*types.App, now time.Time) []*types.Event {
+	var events []*types.Event
+	event := func(typ string, app *types.App) *types.Event {
+		e := &types.Event{Type: typ, Time: now, AppId: app.ID, RunAs: app.RunAs}
+		events = append(events, e)
+		return e
+	}
+
+	for _, id := range sortedAppIds(prev) {
+		if _, ok := cur[id]; !ok {
+			event(types.EventAppDeleted, prev[id])
+		}
+	}
+
+	for _, id := range sortedAppIds(cur) {
+		app, old := cur[id], prev[id]
+		if old == nil {
+			event(types.EventAppCreated, app).State = app.State
+			old = &types.App{}
+		} else if old.State != app.State {
+			e := event(types.EventAppStateChanged, app)
+			e.State = app.State
+			e.Reason = fmt.Sprintf("was %s", old.State)
+		}
+
+		oldTasks := make(map[string]*types.Task)
+		for _, task := range old.Tasks {
+			oldTasks[task.ID] = task
+		}
+
+		for _, task := range app.Tasks {
+			before := oldTasks[task.ID]
+			delete(oldTasks, task.ID)
+
+			if before == nil {
+				before = &types.Task{}
+			}
+
+			// A longer history means the task failed over since.
+			if len(task.History) > len(before.History) {
+				last := task.History[len(task.History)-1]
+				e := event(types.EventTaskFailed, app)
+				e.TaskId, e.State, e.Reason = task.ID, last.State, last.Reason
+			}
+
+			if task.Status != before.Status {
+				typ := types.EventTaskStateChanged
+				switch {
+				case task.Status == "slot_task_running":
+					typ = types.EventTaskStarted
+				case taskFailed(task.Status):
+					typ = types.EventTaskFailed
+				}
+
+				e := event(typ, app)
+				e.TaskId, e.State = task.ID, task.Status
+			}
+
+			if before.ID != "" && task.Healthy != before.Healthy {
+				healthy := task.Healthy
+				e := event(types.EventHealthChanged, app)
+				e.TaskId, e.Healthy = task.ID, &healthy
+			}
+		}
+
+		for _, task := range sortedTasks(oldTasks) {
+			e := event(types.EventTaskRemoved, app)
+			e.TaskId, e.State = task.ID, task.Status
+		}
+	}
+
+	return events
+}
+
+func sortedAppIds(apps map[string]*types.App) []string {
+	ids := make([]string, 0, len(apps))
+	for id := range apps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func sortedTasks(tasks map[string]*types.Task) []*types.Task {
+	list := make([]*types.Task, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, task)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list
+}
+
+// appUser returns the user part of an app id of the form
+// name-user-cluster.
+func appUser(appId string) string {
+	parts := strings.Split(appId, "-")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[len(parts)-2]
+}
+
+func printEventTable(w io.Writer, e *types.Event) {
+	healthy := ""
+	if e.Healthy != nil {
+		healthy = healthyMap[*e.Healthy]
+	}
+
+	state := e.State
+	if s, ok := stateMap[state]; ok {
+		state = s
+	}
+
+	fmt.Fprintf(w, eventFormat,
+		e.Time.Format("2006-01-02 15:04:05"),
+		e.Type,
+		e.AppId,
+		e.TaskId,
+		state,
+		healthy,
+		e.Reason,
+	)
+}
+
+func printEventJSON(w io.Writer, e *types.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(w, string(data))
+}
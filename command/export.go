@@ -0,0 +1,241 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// NewExportCommand returns the CLI command for "export"
+func NewExportCommand() cli.Command {
+	return cli.Command{
+		Name:      "export",
+		Usage:     "write the spec of running applications to files",
+		ArgsUsage: "[app-id]",
+		Description: "Writes the current version of apps as spec files run -f and apply -f\n" +
+			"   read back unchanged. A single app is printed when --dir isn't set.",
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "Export every app of the cluster",
+			},
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "Export the apps of user [USER]",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Export apps of cluster [CLUSTER]",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Value: formatYAML,
+				Usage: "Format of the spec files, yaml or json",
+			},
+			cli.StringFlag{
+				Name:  "dir",
+				Usage: "Write a file per app into `DIR`, named after the app",
+			},
+		}, selectorFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := exportApps(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// exportApps executes the "export" command.
+func exportApps(c *cli.Context) error {
+	format := c.String("output")
+	if format != formatYAML && format != formatJSON {
+		return fmt.Errorf("unknown output %q, expected yaml or json", format)
+	}
+
+	apps, err := exportedApps(c)
+	if err != nil {
+		return err
+	}
+
+	dir := c.String("dir")
+	if dir == "" {
+		if len(apps) != 1 {
+			return fmt.Errorf("%d apps selected, --dir required to export more than one", len(apps))
+		}
+
+		data, err := exportSpec(apps[0], format)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, app := range apps {
+		data, err := exportSpec(app, format)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, app.ID+"."+format)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("write %s failed: %s", path, err.Error())
+		}
+		fmt.Printf("===> exported %s to %s\n", app.ID, path)
+	}
+
+	if len(apps) == 0 {
+		fmt.Println("No apps selected")
+	}
+
+	return nil
+}
+
+// exportedApps gets the app named by the argument, or the apps the flags
+// select, with their current version.
+func exportedApps(c *cli.Context) ([]*types.App, error) {
+	ctx := context.Background()
+
+	if len(c.Args()) > 0 {
+		appId := c.Args()[0]
+		swan, err := appClient(appId, c.String("cluster"))
+		if err != nil {
+			return nil, err
+		}
+
+		app, err := swan.GetApp(ctx, appId)
+		if err != nil {
+			if client.IsNotFound(err) {
+				return nil, fmt.Errorf("app %s not found", appId)
+			}
+			return nil, err
+		}
+
+		if app.CurrentVersion == nil {
+			return nil, fmt.Errorf("current version of %s unknown", appId)
+		}
+
+		return []*types.App{app}, nil
+	}
+
+	filter, err := newAppFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	filter.withField("runAs", c.String("user"))
+
+	if filter.empty() && !c.Bool("all") {
+		return nil, fmt.Errorf("App ID, --all, --user or a selector required")
+	}
+
+	swan, err := clusterClient(c.String("cluster"))
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err := selectApps(ctx, swan, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var exported []*types.App
+	for _, app := range apps {
+		if app.CurrentVersion == nil {
+			detail, err := swan.GetApp(ctx, app.ID)
+			if err != nil {
+				if client.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			app = detail
+		}
+
+		if app.CurrentVersion == nil {
+			fmt.Fprintf(os.Stderr, "Warning: current version of %s unknown, skipped\n", app.ID)
+			continue
+		}
+
+		exported = append(exported, app)
+	}
+
+	return exported, nil
+}
+
+// exportSpec renders the spec an app runs as a spec file, without the
+// label of apply. Decoding the version into a Spec drops the fields swan
+// adds to it.
+func exportSpec(app *types.App, format string) ([]byte, error) {
+	spec := liveSpec(app)
+
+	if _, ok := spec.Labels[managedByLabel]; ok {
+		labels := make(map[string]string, len(spec.Labels))
+		for key, value := range spec.Labels {
+			if key != managedByLabel {
+				labels[key] = value
+			}
+		}
+		spec.Labels = labels
+	}
+
+	return encodeSpec(spec, format)
+}
+
+// encodeSpec renders spec as a spec file in format, yaml or json. Empty
+// fields are left out, so that files only hold what was set.
+func encodeSpec(spec *types.Spec, format string) ([]byte, error) {
+	doc, err := specDoc(spec)
+	if err != nil {
+		return nil, err
+	}
+	doc = plainDoc("", compactDoc("", doc))
+
+	if format == formatJSON {
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+
+	return yaml.Marshal(doc)
+}
+
+// compactDoc removes the empty fields of a spec document. Items of lists
+// are kept, as their position may matter, and so are labels and env
+// variables set to "".
+func compactDoc(path string, val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			item = compactDoc(key, item)
+			if path == "Labels" || path == "Env" || !isEmptyDoc(item) {
+				m[key] = item
+			}
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = compactDoc(path, item)
+		}
+		return list
+	}
+
+	return val
+}
@@ -0,0 +1,281 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// NewHistoryCommand returns the CLI command for "history"
+func NewHistoryCommand() cli.Command {
+	return cli.Command{
+		Name:      "history",
+		Usage:     "list versions of application",
+		ArgsUsage: "[app-id]",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster the application runs in [CLUSTER]",
+			},
+		}, outputFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := listHistory(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			return nil
+		},
+	}
+}
+
+// NewRollbackCommand returns the CLI command for "rollback"
+func NewRollbackCommand() cli.Command {
+	return cli.Command{
+		Name:      "rollback",
+		Usage:     "redeploy a previous version of application",
+		ArgsUsage: "[app-id]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "Version to roll back to, the previous one by default",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster the application runs in [CLUSTER]",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: time.Minute,
+				Usage: "Time to wait for each instance to become healthy",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := rollbackApplication(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// appHistory is an app together with its versions, newest first.
+type appHistory struct {
+	app      *types.App
+	versions []*types.Version
+	// tasks running each version id
+	tasks map[string][]string
+}
+
+func getHistory(swan *client.Client, appId string) (*appHistory, error) {
+	ctx := context.Background()
+	app, err := swan.GetApp(ctx, appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return nil, fmt.Errorf("app %s not found", appId)
+		}
+		return nil, err
+	}
+
+	versions, err := swan.ListVersions(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versionTime(versions[i]).After(versionTime(versions[j]))
+	})
+
+	h := &appHistory{
+		app:      app,
+		versions: versions,
+		tasks:    make(map[string][]string),
+	}
+	for _, task := range app.Tasks {
+		h.tasks[task.VersionId] = append(h.tasks[task.VersionId], task.ID)
+	}
+
+	return h, nil
+}
+
+// current returns the version most tasks run, or the newest one when no
+// task is running.
+func (h *appHistory) current() *types.Version {
+	var current *types.Version
+	for _, v := range h.versions {
+		if current == nil || len(h.tasks[v.ID]) > len(h.tasks[current.ID]) {
+			current = v
+		}
+	}
+
+	return current
+}
+
+// find returns the version with the given id, or the newest version older
+// than the current one if id is empty.
+func (h *appHistory) find(id string) (*types.Version, error) {
+	if id != "" {
+		for _, v := range h.versions {
+			if v.ID == id {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("version %s of %s not found", id, h.app.ID)
+	}
+
+	current := h.current()
+	for i, v := range h.versions {
+		if v == current && i+1 < len(h.versions) {
+			return h.versions[i+1], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no previous version of %s", h.app.ID)
+}
+
+// versionTime returns when a version was created. Versions without a
+// timestamp fall back to their id, which swan derives from the creation
+// time in nanoseconds.
+func versionTime(v *types.Version) time.Time {
+	if !v.Created.IsZero() {
+		return v.Created
+	}
+
+	if ns, err := strconv.ParseInt(v.ID, 10, 64); err == nil {
+		return time.Unix(0, ns)
+	}
+
+	return time.Time{}
+}
+
+// listHistory executes the "history" command.
+func listHistory(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("App ID required")
+	}
+
+	p, err := newPrinter(c)
+	if err != nil {
+		return err
+	}
+
+	swan, err := appClient(c.Args()[0], c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	h, err := getHistory(swan, c.Args()[0])
+	if err != nil {
+		return err
+	}
+
+	return p.print(historyTable(h), h.items())
+}
+
+// versionItem is a version with the tasks running it.
+type versionItem struct {
+	*types.Version
+	Current bool     `json:"current"`
+	Tasks   []string `json:"tasks"`
+}
+
+func (h *appHistory) items() []*versionItem {
+	current := h.current()
+
+	var items []*versionItem
+	for _, v := range h.versions {
+		items = append(items, &versionItem{
+			Version: v,
+			Current: v == current,
+			Tasks:   h.tasks[v.ID],
+		})
+	}
+
+	return items
+}
+
+func historyTable(h *appHistory) *outputTable {
+	current := h.current()
+
+	t := newOutputTable(
+		"CURRENT",
+		"VERSION",
+		"CREATED",
+		"IMAGE",
+		"INSTANCES",
+		"CPUS",
+		"MEM",
+		"TASKS",
+	)
+	t.rowLine = true
+	for _, v := range h.versions {
+		mark := ""
+		if v == current {
+			mark = "*"
+		}
+
+		created := ""
+		if at := versionTime(v); !at.IsZero() {
+			created = at.Format("2006-01-02 15:04:05")
+		}
+
+		t.append(
+			mark,
+			v.ID,
+			created,
+			specImage(&v.Spec),
+			fmt.Sprintf("%d", v.Instances),
+			fmt.Sprintf("%.2f", v.Cpus),
+			fmt.Sprintf("%.f", v.Mem),
+			strings.Join(h.tasks[v.ID], "\n"),
+		)
+	}
+
+	return t
+}
+
+// rollbackApplication executes the "rollback" command.
+func rollbackApplication(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("App ID required")
+	}
+
+	appId := c.Args()[0]
+	swan, err := appClient(appId, c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	h, err := getHistory(swan, appId)
+	if err != nil {
+		return err
+	}
+
+	target, err := h.find(c.String("to"))
+	if err != nil {
+		return err
+	}
+
+	if target == h.current() && len(h.tasks[target.ID]) == len(h.app.Tasks) {
+		fmt.Printf("===> application %s already runs version %s\n", appId, target.ID)
+		return nil
+	}
+
+	fmt.Printf("===> rolling back %s to version %s\n", appId, target.ID)
+	// Only the version is rolled back, the app keeps its instances.
+	spec := target.Spec
+	spec.Instances = int32(h.app.Instances)
+
+	// Tasks already running the target version count as rolled back.
+	r := newRollout(swan, h.app, &spec, c.Duration("wait"))
+	delete(r.previous, target.ID)
+
+	return r.run(&spec)
+}
@@ -1,13 +1,15 @@
 package command
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/Dataman-Cloud/swan/src/types"
-	"github.com/olekukonko/tablewriter"
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
 	"github.com/urfave/cli"
 )
 
@@ -27,16 +29,16 @@ func NewInspectCommand() cli.Command {
 		Name:      "inspect",
 		Usage:     "inspect application info",
 		ArgsUsage: "[name]",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.BoolFlag{
 				Name:  "json",
-				Usage: "List tasks with json format",
+				Usage: "Print the application with json format, same as -o json",
 			},
 			cli.BoolFlag{
 				Name:  "history",
 				Usage: "List task histories",
 			},
-		},
+		}, outputFlags()...),
 
 		Action: func(c *cli.Context) error {
 			if err := inspectApplication(c); err != nil {
@@ -53,48 +55,51 @@ func inspectApplication(c *cli.Context) error {
 		return fmt.Errorf("App ID required")
 	}
 
-	swanAddr, err := getRemote("swan")
+	p, err := newPrinter(c)
 	if err != nil {
 		return err
 	}
-
-	if swanAddr == "" {
-		return fmt.Errorf("swan address not found")
+	if c.Bool("json") {
+		p.format = formatJSON
 	}
 
-	resp, err := http.Get(fmt.Sprintf("%s/apps/%s", swanAddr, c.Args()[0]))
+	swan, err := appClient(c.Args()[0], "")
 	if err != nil {
-		return fmt.Errorf("Unable to do request: %s", err.Error())
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("404")
-	}
-
-	var app *types.App
-	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
 		return err
 	}
 
-	data, err := json.Marshal(&app.Tasks)
+	app, err := swan.GetApp(context.Background(), c.Args()[0])
 	if err != nil {
+		if client.IsNotFound(err) {
+			return fmt.Errorf("app %s not found", c.Args()[0])
+		}
 		return err
 	}
 
-	if c.IsSet("json") {
-		fmt.Fprintln(os.Stdout, string(data))
-	} else {
-		printTaskTable(app.Tasks)
+	sort.Slice(app.Tasks, func(i, j int) bool { return taskLess(app.Tasks[i], app.Tasks[j]) })
+
+	if c.Bool("history") {
+		return p.print(taskHistoryTable(app.Tasks), app)
 	}
 
-	return nil
+	return p.print(taskTable(app.Tasks), app)
 }
 
-// printTable output tasks list as table format.
-func printTaskTable(tasks []*types.Task) {
-	tb := tablewriter.NewWriter(os.Stdout)
-	tb.SetHeader([]string{
+// taskLess orders tasks by their index, the number their id starts with,
+// then by id.
+func taskLess(a, b *types.Task) bool {
+	ai, aerr := strconv.Atoi(strings.SplitN(a.ID, "-", 2)[0])
+	bi, berr := strconv.Atoi(strings.SplitN(b.ID, "-", 2)[0])
+	if aerr == nil && berr == nil && ai != bi {
+		return ai < bi
+	}
+
+	return a.ID < b.ID
+}
+
+// taskTable lists tasks.
+func taskTable(tasks []*types.Task) *outputTable {
+	t := newOutputTable(
 		"Name",
 		"CPUS",
 		"MEM",
@@ -104,19 +109,58 @@ func printTaskTable(tasks []*types.Task) {
 		"VERSIONID",
 		"HISTORIES",
 		"HEALTHY",
-	})
+	).wide(
+		"IP",
+		"AGENT",
+		"CREATED",
+	)
 	for _, task := range tasks {
-		tb.Append([]string{
+		created := ""
+		if !task.Created.IsZero() {
+			created = task.Created.Format("2006-01-02 15:04:05")
+		}
+
+		t.append(
 			task.ID,
-			fmt.Sprintf("%.2f", task.CPU),
+			fmt.Sprintf("%.2f", task.Cpu),
 			fmt.Sprintf("%.f", task.Mem),
 			fmt.Sprintf("%.f", task.Disk),
 			task.Image,
 			stateMap[task.Status],
-			task.VersionID,
+			task.VersionId,
 			fmt.Sprintf("%d", len(task.History)),
 			healthyMap[task.Healthy],
-		})
+			task.IP,
+			task.AgentHostname,
+			created,
+		)
 	}
-	tb.Render()
+
+	return t
+}
+
+// taskHistoryTable lists the previous runs of tasks.
+func taskHistoryTable(tasks []*types.Task) *outputTable {
+	t := newOutputTable(
+		"TASK",
+		"RUN",
+		"AGENT",
+		"VERSIONID",
+		"STATE",
+		"REASON",
+	)
+	for _, task := range tasks {
+		for _, h := range task.History {
+			t.append(
+				task.ID,
+				h.ID,
+				h.AgentHostname,
+				h.VersionId,
+				h.State,
+				h.Reason,
+			)
+		}
+	}
+
+	return t
 }
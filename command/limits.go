@@ -0,0 +1,236 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Dataman-Cloud/swancfg/types"
+)
+
+// quotaNeed is what a change adds to the resources used by a user, and
+// the size of one of its instances.
+type quotaNeed struct {
+	Cpu       float64
+	Memory    float64
+	Disk      float64
+	Instances int
+	Apps      int
+
+	InstanceCpu    float64
+	InstanceMemory float64
+}
+
+// specNeed returns what instances instances of spec use.
+func specNeed(spec *types.Spec, instances int) *quotaNeed {
+	n := float64(instances)
+
+	return &quotaNeed{
+		Cpu:            n * spec.Cpus,
+		Memory:         n * spec.Mem,
+		Disk:           n * spec.Disk,
+		Instances:      instances,
+		InstanceCpu:    spec.Cpus,
+		InstanceMemory: spec.Mem,
+	}
+}
+
+// subtract removes what is already used by o from the totals of n,
+// leaving nothing negative.
+func (n *quotaNeed) subtract(o *quotaNeed) {
+	n.Cpu = positive(n.Cpu - o.Cpu)
+	n.Memory = positive(n.Memory - o.Memory)
+	n.Disk = positive(n.Disk - o.Disk)
+	n.Instances = int(positive(float64(n.Instances - o.Instances)))
+	n.Apps = int(positive(float64(n.Apps - o.Apps)))
+}
+
+// grows reports whether n adds anything to the resources used.
+func (n *quotaNeed) grows() bool {
+	return n.Cpu > 0 || n.Memory > 0 || n.Disk > 0 || n.Instances > 0 || n.Apps > 0
+}
+
+// quotaDimension is one limit of a quota. Totals limit the sum used by
+// every app of a user, the others the size of a single instance.
+type quotaDimension struct {
+	Name     string
+	Flag     string
+	Usage    string
+	integer  bool
+	optional bool
+	total    bool
+
+	limit func(*types.Quota) float64
+	set   func(*types.Quota, float64)
+	used  func(*usage) float64
+	need  func(*quotaNeed) float64
+}
+
+var quotaDimensions = []*quotaDimension{
+	{
+		Name:  "cpu",
+		Flag:  "cpu",
+		Usage: "Cpus the user may use in the cluster",
+		total: true,
+		limit: func(q *types.Quota) float64 { return q.Cpu },
+		set:   func(q *types.Quota, v float64) { q.Cpu = v },
+		used:  func(u *usage) float64 { return u.Cpu },
+		need:  func(n *quotaNeed) float64 { return n.Cpu },
+	},
+	{
+		Name:  "memory",
+		Flag:  "mem",
+		Usage: "Memory in MB the user may use in the cluster",
+		total: true,
+		limit: func(q *types.Quota) float64 { return q.Memory },
+		set:   func(q *types.Quota, v float64) { q.Memory = v },
+		used:  func(u *usage) float64 { return u.Mem },
+		need:  func(n *quotaNeed) float64 { return n.Memory },
+	},
+	{
+		Name:     "disk",
+		Flag:     "disk",
+		Usage:    "Disk in MB the user may use in the cluster, 0 for no limit",
+		total:    true,
+		optional: true,
+		limit:    func(q *types.Quota) float64 { return q.Disk },
+		set:      func(q *types.Quota, v float64) { q.Disk = v },
+		used:     func(u *usage) float64 { return u.Disk },
+		need:     func(n *quotaNeed) float64 { return n.Disk },
+	},
+	{
+		Name:     "instances",
+		Flag:     "instances",
+		Usage:    "Instances the user may run in the cluster, 0 for no limit",
+		total:    true,
+		integer:  true,
+		optional: true,
+		limit:    func(q *types.Quota) float64 { return float64(q.Instances) },
+		set:      func(q *types.Quota, v float64) { q.Instances = int(v) },
+		used:     func(u *usage) float64 { return float64(u.Instances) },
+		need:     func(n *quotaNeed) float64 { return float64(n.Instances) },
+	},
+	{
+		Name:     "apps",
+		Flag:     "apps",
+		Usage:    "Apps the user may run in the cluster, 0 for no limit",
+		total:    true,
+		integer:  true,
+		optional: true,
+		limit:    func(q *types.Quota) float64 { return float64(q.Apps) },
+		set:      func(q *types.Quota, v float64) { q.Apps = int(v) },
+		used:     func(u *usage) float64 { return float64(u.Apps) },
+		need:     func(n *quotaNeed) float64 { return float64(n.Apps) },
+	},
+	{
+		Name:     "maxInstanceCpu",
+		Flag:     "max-instance-cpu",
+		Usage:    "Cpus a single instance may use, 0 for no limit",
+		optional: true,
+		limit:    func(q *types.Quota) float64 { return q.MaxInstanceCpu },
+		set:      func(q *types.Quota, v float64) { q.MaxInstanceCpu = v },
+		need:     func(n *quotaNeed) float64 { return n.InstanceCpu },
+	},
+	{
+		Name:     "maxInstanceMemory",
+		Flag:     "max-instance-mem",
+		Usage:    "Memory in MB a single instance may use, 0 for no limit",
+		optional: true,
+		limit:    func(q *types.Quota) float64 { return q.MaxInstanceMemory },
+		set:      func(q *types.Quota, v float64) { q.MaxInstanceMemory = v },
+		need:     func(n *quotaNeed) float64 { return n.InstanceMemory },
+	},
+}
+
+// quotaHeader returns the columns of a quota in tables: the limit and use
+// of every total, then the per-instance maximums.
+func quotaHeader() []string {
+	var header []string
+	for _, d := range quotaDimensions {
+		if d.total {
+			header = append(header, strings.ToUpper(d.Name), "USED")
+		} else {
+			header = append(header, strings.ToUpper(d.Flag))
+		}
+	}
+
+	return header
+}
+
+// quotaRow returns the columns of quotaHeader for q and used.
+func quotaRow(q *types.Quota, used *usage) []string {
+	var row []string
+	for _, d := range quotaDimensions {
+		row = append(row, d.formatLimit(q))
+		if d.total {
+			row = append(row, d.format(d.used(used)))
+		}
+	}
+
+	return row
+}
+
+// limited reports whether q limits this dimension at all.
+func (d *quotaDimension) limited(q *types.Quota) bool {
+	return !d.optional || d.limit(q) > 0
+}
+
+// exceeded reports whether need doesn't fit in what q leaves after used.
+func (d *quotaDimension) exceeded(q *types.Quota, used *usage, need *quotaNeed) bool {
+	if !d.limited(q) || d.need(need) <= 0 {
+		return false
+	}
+
+	if !d.total {
+		return d.need(need) > d.limit(q)
+	}
+
+	return d.need(need) > d.limit(q)-d.used(used)
+}
+
+// format prints a value of the dimension as the tables show it.
+func (d *quotaDimension) format(v float64) string {
+	if d.integer {
+		return strconv.Itoa(int(v))
+	}
+
+	return fmt.Sprintf("%.2f", v)
+}
+
+// formatLimit prints the limit of q, or "-" when there is none.
+func (d *quotaDimension) formatLimit(q *types.Quota) string {
+	if q == nil || !d.limited(q) {
+		return "-"
+	}
+
+	return d.format(d.limit(q))
+}
+
+// parse reads a value of the dimension from a file or a flag.
+func (d *quotaDimension) parse(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || (d.integer && v != float64(int(v))) {
+		return 0, fmt.Errorf("invalid %s %q", d.Name, s)
+	}
+
+	return v, nil
+}
+
+// validQuota reports whether every limit of q is a possible value.
+func validQuota(q *types.Quota) bool {
+	if q == nil {
+		return false
+	}
+
+	for _, d := range quotaDimensions {
+		if d.limit(q) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,14 +1,12 @@
 package command
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"os"
-	"strings"
+	"sort"
 
 	"github.com/Dataman-Cloud/swancfg/types"
-	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 )
 
@@ -16,10 +14,10 @@ func NewListCommand() cli.Command {
 	return cli.Command{
 		Name:  "list",
 		Usage: "list all applications",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.BoolFlag{
 				Name:  "json",
-				Usage: "List apps with json format",
+				Usage: "List apps with json format, same as -o json",
 			},
 			cli.BoolFlag{
 				Name:  "all",
@@ -33,7 +31,7 @@ func NewListCommand() cli.Command {
 				Name:  "user",
 				Usage: "List apps belong to user [USER]",
 			},
-		},
+		}, append(selectorFlags(), outputFlags()...)...),
 		Action: func(c *cli.Context) error {
 			if err := listApps(c); err != nil {
 				fmt.Fprintln(os.Stderr, "Error:", err)
@@ -45,97 +43,37 @@ func NewListCommand() cli.Command {
 }
 
 func listApps(c *cli.Context) error {
-
-	var apps []*types.App
-
-	cluster, user := c.String("cluster"), c.String("user")
-
-	if cluster == "" && user == "" {
-		apps, _ = getAllApps("")
-	}
-
-	if cluster != "" && user == "" {
-		apps, _ = getAppsByClusterID(cluster)
+	p, err := newPrinter(c)
+	if err != nil {
+		return err
 	}
-
-	if cluster == "" && user != "" {
-		apps, _ = getAppsByUser(user)
+	if c.Bool("json") {
+		p.format = formatJSON
 	}
 
-	if cluster != "" && user != "" {
-		apps, _ = getAppsByClusterAndUser(cluster, user)
-	}
-
-	printTable(apps)
-
-	return nil
-}
-
-func getAllApps(filter string) ([]*types.App, error) {
-	swanAddr, err := getRemote("swan")
+	filter, err := newAppFilter(c)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	filter.withField("runAs", c.String("user"))
 
-	var allApps []*types.App
-	resp, err := http.Get(fmt.Sprintf("%s/apps/?fields=%s", swanAddr, filter))
+	swan, err := clusterClient(c.String("cluster"))
 	if err != nil {
-		return nil, fmt.Errorf("%s", err.Error())
+		return err
 	}
-	defer resp.Body.Close()
-	var apps []*types.App
-	if err := json.NewDecoder(resp.Body).Decode(&apps); err != nil {
-		return nil, fmt.Errorf("%s", err.Error())
-	}
-
-	allApps = append(allApps, apps...)
-
-	return allApps, nil
-}
 
-func getAppsByClusterID(clusterId string) ([]*types.App, error) {
-	swanAddr, err := getRemote("swan")
+	apps, err := selectApps(context.Background(), swan, filter)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if swanAddr == "" {
-		return nil, fmt.Errorf("swan address not found")
-	}
-
-	resp, _ := http.Get(fmt.Sprintf("%s/apps/", swanAddr))
-	defer resp.Body.Close()
-	var apps []*types.App
-	if err := json.NewDecoder(resp.Body).Decode(&apps); err != nil {
-		return nil, err
-	}
-
-	return apps, nil
-}
-
-func getAppsByUser(user string) ([]*types.App, error) {
-	fmt.Println("get apps by user")
-	filter := fmt.Sprintf("runAs==%s", user)
-
-	return getAllApps(filter)
-}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
 
-func getAppsByClusterAndUser(clusterId, userId string) ([]*types.App, error) {
-	apps, _ := getAppsByClusterID(clusterId)
-
-	var results []*types.App
-	for _, app := range apps {
-		if app.RunAs == userId {
-			results = append(results, app)
-		}
-	}
-
-	return results, nil
+	return p.print(appTable(apps), apps)
 }
 
-func printTable(apps []*types.App) {
-	tb := tablewriter.NewWriter(os.Stdout)
-	tb.SetHeader([]string{
+func appTable(apps []*types.App) *outputTable {
+	t := newOutputTable(
 		"ID",
 		"Name",
 		"Instances",
@@ -144,18 +82,35 @@ func printTable(apps []*types.App) {
 		"State",
 		"Created",
 		"Updated",
-	})
+	).wide(
+		"Running",
+		"Cpus",
+		"Mem",
+		"Image",
+	)
 	for _, app := range apps {
-		tb.Append([]string{
+		var cpus, mem, image string
+		if spec := app.CurrentVersion; spec != nil {
+			cpus = fmt.Sprintf("%.2f", spec.Cpus)
+			mem = fmt.Sprintf("%.f", spec.Mem)
+			image = specImage(spec)
+		}
+
+		t.append(
 			app.ID,
 			app.Name,
 			fmt.Sprintf("%d", app.Instances),
 			app.RunAs,
-			strings.Split(app.ID, "-")[2],
+			appCluster(app.ID),
 			app.State,
 			app.Created.Format("2006-01-02 15:04:05"),
 			app.Updated.Format("2006-01-02 15:04:05"),
-		})
+			fmt.Sprintf("%d", app.RunningInstances),
+			cpus,
+			mem,
+			image,
+		)
 	}
-	tb.Render()
+
+	return t
 }
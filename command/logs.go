@@ -0,0 +1,208 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+const logsPollInterval = 2 * time.Second
+
+// NewLogsCommand returns the CLI command for "logs"
+func NewLogsCommand() cli.Command {
+	return cli.Command{
+		Name:      "logs",
+		Usage:     "print stdout and stderr of application tasks",
+		ArgsUsage: "[app-id]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "task",
+				Usage: "Only print the output of task [TASK]",
+			},
+			cli.BoolFlag{
+				Name:  "previous",
+				Usage: "Print the output of the previous run of the tasks",
+			},
+			cli.BoolFlag{
+				Name:  "follow, f",
+				Usage: "Keep printing new output",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster the application runs in [CLUSTER]",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := printLogs(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			return nil
+		},
+	}
+}
+
+// sandboxLog tails the stdout and stderr files of one task sandbox.
+type sandboxLog struct {
+	sandbox *client.Sandbox
+	stdout  io.Writer
+	stderr  io.Writer
+	offsets map[string]int64
+}
+
+func (l *sandboxLog) poll() error {
+	files := []struct {
+		name string
+		w    io.Writer
+	}{
+		{"stdout", l.stdout},
+		{"stderr", l.stderr},
+	}
+
+	for _, f := range files {
+		data, offset, err := l.sandbox.Read(context.Background(), f.name, l.offsets[f.name])
+		io.WriteString(f.w, data)
+		l.offsets[f.name] = offset
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printLogs executes the "logs" command.
+func printLogs(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("App ID required")
+	}
+
+	appId := c.Args()[0]
+	cluster, err := getAppCluster(appId, c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	app, err := newClient(cluster).GetApp(context.Background(), appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return fmt.Errorf("app %s not found", appId)
+		}
+		return err
+	}
+
+	var tasks []*types.Task
+	for _, task := range app.Tasks {
+		if c.String("task") == "" || task.ID == c.String("task") {
+			tasks = append(tasks, task)
+		}
+	}
+
+	if len(tasks) == 0 {
+		if c.String("task") != "" {
+			return fmt.Errorf("task %s of %s not found", c.String("task"), appId)
+		}
+		return fmt.Errorf("app %s has no tasks", appId)
+	}
+
+	var (
+		mesos *client.Mesos
+		logs  []*sandboxLog
+	)
+	for _, task := range tasks {
+		prefix := ""
+		if len(tasks) > 1 {
+			prefix = task.ID + " | "
+		}
+		stdout, stderr := newPrefixWriter(os.Stdout, prefix), newPrefixWriter(os.Stderr, prefix)
+
+		agentId, taskId := task.AgentId, task.ID
+		if c.Bool("previous") {
+			if len(task.History) == 0 {
+				fmt.Fprintf(os.Stderr, "Task %s has no previous run\n", task.ID)
+				continue
+			}
+
+			prev := task.History[len(task.History)-1]
+			if prev.Stdout != "" || prev.Stderr != "" {
+				io.WriteString(stdout, prev.Stdout)
+				io.WriteString(stderr, prev.Stderr)
+				if prev.State != "" {
+					fmt.Fprintf(stderr, "%s %s\n", prev.State, prev.Reason)
+				}
+				continue
+			}
+			agentId, taskId = prev.AgentId, prev.ID
+		}
+
+		// Swan has no output for this run, read the mesos sandbox.
+		if mesos == nil {
+			if mesos, err = mesosClient(cluster); err != nil {
+				return err
+			}
+		}
+
+		sandbox, err := mesos.Sandbox(context.Background(), agentId, taskId)
+		if err != nil {
+			return err
+		}
+
+		logs = append(logs, &sandboxLog{
+			sandbox: sandbox,
+			stdout:  stdout,
+			stderr:  stderr,
+			offsets: make(map[string]int64),
+		})
+	}
+
+	for {
+		for _, l := range logs {
+			if err := l.poll(); err != nil {
+				return err
+			}
+		}
+
+		if !c.Bool("follow") || len(logs) == 0 {
+			return nil
+		}
+
+		time.Sleep(logsPollInterval)
+	}
+}
+
+// prefixWriter starts every line written through it with prefix.
+type prefixWriter struct {
+	w         io.Writer
+	prefix    []byte
+	lineStart bool
+}
+
+func newPrefixWriter(w io.Writer, prefix string) io.Writer {
+	if prefix == "" {
+		return w
+	}
+
+	return &prefixWriter{w: w, prefix: []byte(prefix), lineStart: true}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	var buf []byte
+	for _, b := range data {
+		if p.lineStart {
+			buf = append(buf, p.prefix...)
+		}
+		buf = append(buf, b)
+		p.lineStart = b == '\n'
+	}
+
+	if _, err := p.w.Write(buf); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
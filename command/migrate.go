@@ -0,0 +1,180 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/urfave/cli"
+)
+
+// NewMigrateCommand returns the CLI command for "migrate"
+func NewMigrateCommand() cli.Command {
+	return cli.Command{
+		Name:      "migrate",
+		Usage:     "move an application to another cluster",
+		ArgsUsage: "[app-id]",
+		Description: "Creates the app in the target cluster, waits for it to be running and\n" +
+			"   healthy, then deletes it from the source cluster. The new app is deleted\n" +
+			"   again when a step fails, leaving the source app as it was.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "Cluster to move the application to [CLUSTER]",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster the application runs in [CLUSTER]",
+			},
+			cli.BoolFlag{
+				Name:  "disable-quota",
+				Usage: "Disable quota check",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: 2 * time.Minute,
+				Usage: "Time to wait for the instances in the target cluster to be running and healthy",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := migrateApplication(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// migrateApplication executes the "migrate" command.
+func migrateApplication(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("App ID required")
+	}
+
+	appId, to := c.Args()[0], c.String("to")
+	if to == "" {
+		return fmt.Errorf("target cluster required, set it with --to")
+	}
+
+	source, err := appClient(appId, c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	app, err := source.GetApp(ctx, appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return fmt.Errorf("app %s not found", appId)
+		}
+		return err
+	}
+
+	if app.CurrentVersion == nil {
+		return fmt.Errorf("current version of %s unknown, can't migrate it", appId)
+	}
+
+	spec := liveSpec(app)
+	from := spec.Cluster
+	if from == "" {
+		from = appCluster(appId)
+	}
+	if from == to {
+		return fmt.Errorf("app %s already runs in cluster %s", appId, to)
+	}
+	spec.Cluster = to
+
+	target, err := clusterClient(to)
+	if err != nil {
+		return err
+	}
+
+	targetId := specAppID(spec)
+	if _, err := target.GetApp(ctx, targetId); err == nil {
+		return fmt.Errorf("app %s already exists in cluster %s", targetId, to)
+	} else if !client.IsNotFound(err) {
+		return err
+	}
+
+	if !c.Bool("disable-quota") {
+		if err := checkQuota(spec); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("===> creating %s in cluster:%s...", targetId, to)
+	if err := target.CreateApp(ctx, spec); err != nil {
+		fmt.Println("failed")
+		return err
+	}
+	fmt.Println("done")
+
+	checked := len(spec.HealthChecks) > 0
+	if err := waitForReady(target, targetId, int(spec.Instances), checked, c.Duration("wait")); err != nil {
+		return rollbackMigration(target, targetId, err)
+	}
+
+	fmt.Printf("===> deleting %s from cluster:%s...", appId, from)
+	if err := source.DeleteApp(ctx, appId); err != nil {
+		fmt.Println("failed")
+		return rollbackMigration(target, targetId, err)
+	}
+	fmt.Println("done")
+
+	fmt.Printf("===> application %s migrated to %s\n", appId, targetId)
+	return nil
+}
+
+// rollbackMigration deletes the app created in the target cluster after
+// cause made the migration fail.
+func rollbackMigration(target *client.Client, targetId string, cause error) error {
+	fmt.Printf("===> rolling back, deleting %s...", targetId)
+	if err := target.DeleteApp(context.Background(), targetId); err != nil {
+		fmt.Println("failed")
+		return fmt.Errorf("%s, and rollback failed, delete %s by hand: %s", cause, targetId, err.Error())
+	}
+	fmt.Println("done")
+
+	return fmt.Errorf("migration rolled back: %s", cause)
+}
+
+// waitForReady waits until target tasks of the app are running and, when
+// checked, healthy, redrawing the progress on a single line.
+func waitForReady(swan *client.Client, appId string, target int, checked bool, timeout time.Duration) error {
+	var ready int
+	ok, err := waitFor(timeout, func() (bool, error) {
+		app, err := swan.GetApp(context.Background(), appId)
+		if err != nil {
+			return false, err
+		}
+
+		ready = 0
+		for _, task := range app.Tasks {
+			if taskReady(task, checked) {
+				ready++
+			}
+		}
+
+		state := "running"
+		if checked {
+			state = "healthy"
+		}
+		fmt.Printf("\r===> waiting for %s: %d/%d instances %s", appId, ready, target, state)
+
+		return ready >= target, nil
+	})
+	fmt.Println()
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("timeout after %s with %d/%d instances ready", timeout, ready, target)
+	}
+
+	return nil
+}
@@ -0,0 +1,467 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of the --output flag besides formatJSON and formatYAML.
+// Template and jsonpath take their argument after an equal sign.
+const (
+	formatTable    = "table"
+	formatWide     = "wide"
+	formatTemplate = "template"
+	formatJSONPath = "jsonpath"
+)
+
+// outputFlags returns the flags choosing how a read command prints.
+func outputFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: formatTable,
+			Usage: "Output format: table, wide, json, yaml, template=TEMPLATE or jsonpath=EXPR",
+		},
+		cli.BoolFlag{
+			Name:  "no-headers",
+			Usage: "Don't print the table headers, for scripting",
+		},
+	}
+}
+
+// printer prints the result of a read command in the format chosen with
+// --output. Tables are built from rows, the other formats from the items
+// the rows come from.
+type printer struct {
+	w         io.Writer
+	format    string
+	template  *template.Template
+	jsonpath  []*jsonpathNode
+	noHeaders bool
+}
+
+// newPrinter checks the output flags, so that a bad template fails before
+// anything is fetched.
+func newPrinter(c *cli.Context) (*printer, error) {
+	p := &printer{
+		w:         os.Stdout,
+		noHeaders: c.Bool("no-headers"),
+	}
+
+	format, arg := c.String("output"), ""
+	if i := strings.Index(format, "="); i >= 0 {
+		format, arg = format[:i], format[i+1:]
+	}
+	p.format = format
+
+	switch format {
+	case formatTable, formatWide, formatJSON, formatYAML:
+		if arg != "" {
+			return nil, fmt.Errorf("output %s takes no argument", format)
+		}
+	case formatTemplate:
+		tmpl, err := template.New("output").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %s", err.Error())
+		}
+		p.template = tmpl
+	case formatJSONPath:
+		nodes, err := parseJSONPath(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jsonpath: %s", err.Error())
+		}
+		p.jsonpath = nodes
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected table, wide, json, yaml, template=TEMPLATE or jsonpath=EXPR", c.String("output"))
+	}
+
+	return p, nil
+}
+
+// print writes t for the table formats, items for the others.
+func (p *printer) print(t *outputTable, items interface{}) error {
+	// No items are an empty list rather than null.
+	if v := reflect.ValueOf(items); v.Kind() == reflect.Slice && v.IsNil() {
+		items = []interface{}{}
+	}
+
+	switch p.format {
+	case formatTable, formatWide:
+		t.render(p.w, p.format == formatWide, !p.noHeaders)
+		return nil
+	case formatJSON:
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(p.w, string(data))
+		return nil
+	}
+
+	doc, err := outputDoc(items)
+	if err != nil {
+		return err
+	}
+
+	switch p.format {
+	case formatYAML:
+		data, err := yaml.Marshal(yamlDoc(doc))
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(p.w, string(data))
+	case formatTemplate:
+		if err := p.template.Execute(p.w, doc); err != nil {
+			return fmt.Errorf("execute template failed: %s", err.Error())
+		}
+	case formatJSONPath:
+		var buf bytes.Buffer
+		if err := executeJSONPath(&buf, p.jsonpath, doc, doc); err != nil {
+			return err
+		}
+		fmt.Fprint(p.w, buf.String())
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			fmt.Fprintln(p.w)
+		}
+	}
+
+	return nil
+}
+
+// outputDoc converts items to the shape encoding/json decodes to, so that
+// templates and paths use the json field names.
+func outputDoc(items interface{}) (interface{}, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// yamlDoc turns the json numbers of doc into numbers yaml prints
+// unquoted.
+func yamlDoc(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = yamlDoc(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlDoc(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+
+	return doc
+}
+
+// outputTable holds the rows of a table. Columns after the first
+// len(header) are only printed by -o wide.
+type outputTable struct {
+	header     []string
+	wideHeader []string
+	rows       [][]string
+
+	rowLine bool
+	wrap    bool
+}
+
+func newOutputTable(header ...string) *outputTable {
+	return &outputTable{header: header, wrap: true}
+}
+
+// wide adds columns only printed by -o wide.
+func (t *outputTable) wide(header ...string) *outputTable {
+	t.wideHeader = append(t.wideHeader, header...)
+	return t
+}
+
+// append adds a row, with the values of the wide columns last.
+func (t *outputTable) append(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+func (t *outputTable) render(w io.Writer, wide, headers bool) {
+	columns := len(t.header)
+	header := t.header
+	if wide {
+		columns += len(t.wideHeader)
+		header = append(append([]string{}, t.header...), t.wideHeader...)
+	}
+
+	tb := tablewriter.NewWriter(w)
+	tb.SetAutoWrapText(t.wrap)
+	if headers {
+		tb.SetHeader(header)
+		tb.SetRowLine(t.rowLine)
+	} else {
+		// Plain columns separated by spaces are easier to cut and awk.
+		tb.SetBorder(false)
+		tb.SetColumnSeparator("")
+		tb.SetAlignment(tablewriter.ALIGN_LEFT)
+	}
+
+	for _, row := range t.rows {
+		if len(row) > columns {
+			row = row[:columns]
+		}
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		tb.Append(row)
+	}
+	tb.Render()
+}
+
+// jsonpathNode is a piece of a jsonpath template: literal text, a path
+// whose values are printed, or a range over the values of a path.
+type jsonpathNode struct {
+	text   string
+	path   []string
+	body   []*jsonpathNode
+	ranged bool
+}
+
+// parseJSONPath parses the subset of the kubectl jsonpath syntax swancfg
+// supports: {.field}, {[0]}, {[*]}, {$} for the root, {"text"} and
+// {range PATH}...{end}. A template without braces is a single path.
+func parseJSONPath(s string) ([]*jsonpathNode, error) {
+	if !strings.Contains(s, "{") {
+		s = "{" + s + "}"
+	}
+
+	nodes, _, err := parseJSONPathNodes(s, false)
+
+	return nodes, err
+}
+
+func parseJSONPathNodes(s string, inRange bool) ([]*jsonpathNode, string, error) {
+	var nodes []*jsonpathNode
+	for s != "" {
+		open := strings.Index(s, "{")
+		if open < 0 {
+			nodes = append(nodes, &jsonpathNode{text: s})
+			s = ""
+			break
+		}
+		if open > 0 {
+			nodes = append(nodes, &jsonpathNode{text: s[:open]})
+		}
+
+		end := strings.Index(s[open:], "}")
+		if end < 0 {
+			return nil, "", fmt.Errorf("unclosed { in %q", s[open:])
+		}
+		expr := strings.TrimSpace(s[open+1 : open+end])
+		s = s[open+end+1:]
+
+		switch {
+		case expr == "end":
+			if !inRange {
+				return nil, "", fmt.Errorf("{end} without {range}")
+			}
+			return nodes, s, nil
+		case strings.HasPrefix(expr, "range "):
+			path, err := parseJSONPathExpr(strings.TrimSpace(strings.TrimPrefix(expr, "range ")))
+			if err != nil {
+				return nil, "", err
+			}
+			body, rest, err := parseJSONPathNodes(s, true)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, &jsonpathNode{path: path, body: body, ranged: true})
+			s = rest
+		case strings.HasPrefix(expr, `"`):
+			text, err := strconv.Unquote(expr)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid string %s", expr)
+			}
+			nodes = append(nodes, &jsonpathNode{text: text})
+		default:
+			path, err := parseJSONPathExpr(expr)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, &jsonpathNode{path: path})
+		}
+	}
+
+	if inRange {
+		return nil, "", fmt.Errorf("{range} without {end}")
+	}
+
+	return nodes, "", nil
+}
+
+// parseJSONPathExpr splits a path like $.apps[*].id into the steps "$",
+// "apps", "[*]" and "id".
+func parseJSONPathExpr(expr string) ([]string, error) {
+	// Not nil even for {.}, which nodes of text are told apart by.
+	steps := []string{}
+	if strings.HasPrefix(expr, "$") {
+		steps = append(steps, "$")
+		expr = expr[1:]
+	}
+
+	for expr != "" {
+		switch expr[0] {
+		case '.':
+			expr = expr[1:]
+			n := strings.IndexAny(expr, ".[")
+			if n < 0 {
+				n = len(expr)
+			}
+			if n > 0 {
+				steps = append(steps, expr[:n])
+			}
+			expr = expr[n:]
+		case '[':
+			n := strings.Index(expr, "]")
+			if n < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", expr)
+			}
+			index := expr[1:n]
+			if index != "*" {
+				if _, err := strconv.Atoi(index); err != nil {
+					return nil, fmt.Errorf("invalid index [%s]", index)
+				}
+			}
+			steps = append(steps, "["+index+"]")
+			expr = expr[n+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q", expr)
+		}
+	}
+
+	return steps, nil
+}
+
+func executeJSONPath(w io.Writer, nodes []*jsonpathNode, root, current interface{}) error {
+	for _, node := range nodes {
+		if node.path == nil {
+			io.WriteString(w, node.text)
+			continue
+		}
+
+		values := evalJSONPath(node.path, root, current)
+		if node.ranged {
+			for _, v := range values {
+				if err := executeJSONPath(w, node.body, root, v); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for i, v := range values {
+			if i > 0 {
+				io.WriteString(w, " ")
+			}
+			if err := writeJSONPathValue(w, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// evalJSONPath returns the values path selects. Missing fields select
+// nothing, as fields left empty are omitted from the items.
+func evalJSONPath(path []string, root, current interface{}) []interface{} {
+	values := []interface{}{current}
+	for _, step := range path {
+		var next []interface{}
+		for _, v := range values {
+			switch {
+			case step == "$":
+				next = append(next, root)
+			case step == "[*]":
+				switch val := v.(type) {
+				case []interface{}:
+					next = append(next, val...)
+				case map[string]interface{}:
+					for _, key := range sortedDocKeys(val) {
+						next = append(next, val[key])
+					}
+				}
+			case strings.HasPrefix(step, "["):
+				list, ok := v.([]interface{})
+				if !ok {
+					continue
+				}
+				i, _ := strconv.Atoi(step[1 : len(step)-1])
+				if i < 0 {
+					i += len(list)
+				}
+				if i >= 0 && i < len(list) {
+					next = append(next, list[i])
+				}
+			default:
+				if m, ok := v.(map[string]interface{}); ok {
+					if item, ok := m[step]; ok {
+						next = append(next, item)
+					}
+				}
+			}
+		}
+		values = next
+	}
+
+	return values
+}
+
+func writeJSONPathValue(w io.Writer, v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		io.WriteString(w, val)
+	case json.Number:
+		io.WriteString(w, val.String())
+	case nil:
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		w.Write(data)
+	}
+
+	return nil
+}
+
+func sortedDocKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,238 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONPathExpr(t *testing.T) {
+	tests := []struct {
+		expr  string
+		steps []string
+		err   bool
+	}{
+		{expr: "", steps: []string{}},
+		{expr: ".", steps: []string{}},
+		{expr: "$", steps: []string{"$"}},
+		{expr: ".id", steps: []string{"id"}},
+		{expr: "$.apps[*].id", steps: []string{"$", "apps", "[*]", "id"}},
+		{expr: ".tasks[0].ip", steps: []string{"tasks", "[0]", "ip"}},
+		{expr: ".tasks[-1]", steps: []string{"tasks", "[-1]"}},
+		{expr: "[*]", steps: []string{"[*]"}},
+		{expr: ".currentVersion.labels.team", steps: []string{"currentVersion", "labels", "team"}},
+		{expr: ".tasks[0", err: true},
+		{expr: ".tasks[a]", err: true},
+		{expr: "id", err: true},
+	}
+
+	for _, test := range tests {
+		steps, err := parseJSONPathExpr(test.expr)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseJSONPathExpr(%q) = %q, want an error", test.expr, steps)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseJSONPathExpr(%q) failed: %s", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("parseJSONPathExpr(%q) = %q, want %q", test.expr, steps, test.steps)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		template string
+		nodes    []*jsonpathNode
+		err      bool
+	}{
+		{
+			template: ".id",
+			nodes:    []*jsonpathNode{{path: []string{"id"}}},
+		},
+		{
+			template: "{.id}",
+			nodes:    []*jsonpathNode{{path: []string{"id"}}},
+		},
+		{
+			template: `id: {.id}{"\n"}`,
+			nodes: []*jsonpathNode{
+				{text: "id: "},
+				{path: []string{"id"}},
+				{text: "\n"},
+			},
+		},
+		{
+			template: `{range .items[*]}{.id}{"\t"}{.state}{"\n"}{end}`,
+			nodes: []*jsonpathNode{
+				{
+					path:   []string{"items", "[*]"},
+					ranged: true,
+					body: []*jsonpathNode{
+						{path: []string{"id"}},
+						{text: "\t"},
+						{path: []string{"state"}},
+						{text: "\n"},
+					},
+				},
+			},
+		},
+		{
+			template: "{range [*]}{range .tasks[*]}{.ip} {end}{end}done",
+			nodes: []*jsonpathNode{
+				{
+					path:   []string{"[*]"},
+					ranged: true,
+					body: []*jsonpathNode{
+						{
+							path:   []string{"tasks", "[*]"},
+							ranged: true,
+							body: []*jsonpathNode{
+								{path: []string{"ip"}},
+								{text: " "},
+							},
+						},
+					},
+				},
+				{text: "done"},
+			},
+		},
+		{template: "{.id", err: true},
+		{template: "{end}", err: true},
+		{template: "{range .items[*]}{.id}", err: true},
+		{template: `{"unterminated}`, err: true},
+		{template: "{.tasks[x]}", err: true},
+	}
+
+	for _, test := range tests {
+		nodes, err := parseJSONPath(test.template)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseJSONPath(%q) succeeded, want an error", test.template)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseJSONPath(%q) failed: %s", test.template, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(nodes, test.nodes) {
+			t.Errorf("parseJSONPath(%q) = %s, want %s", test.template, nodesString(nodes), nodesString(test.nodes))
+		}
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	root := decodeDoc(t, `{
+		"apps": [
+			{"id": "web", "instances": 2, "labels": {"team": "pay", "env": "prod"}, "tasks": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}]},
+			{"id": "api", "instances": 1, "tasks": []}
+		]
+	}`)
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$", `[{"apps":[{"id":"web","instances":2,"labels":{"env":"prod","team":"pay"},"tasks":[{"ip":"10.0.0.1"},{"ip":"10.0.0.2"}]},{"id":"api","instances":1,"tasks":[]}]}]`},
+		{".apps[*].id", `["web","api"]`},
+		{".apps[0].instances", `[2]`},
+		{".apps[-1].id", `["api"]`},
+		{".apps[2].id", `null`},
+		{".apps[*].tasks[*].ip", `["10.0.0.1","10.0.0.2"]`},
+		{".apps[0].labels[*]", `["prod","pay"]`},
+		{".apps[*].labels.team", `["pay"]`},
+		{".apps[*].missing", `null`},
+		{".apps.id", `null`},
+		{".apps[0].id[0]", `null`},
+	}
+
+	for _, test := range tests {
+		path, err := parseJSONPathExpr(test.expr)
+		if err != nil {
+			t.Fatalf("parseJSONPathExpr(%q) failed: %s", test.expr, err)
+		}
+
+		data, err := json.Marshal(evalJSONPath(path, root, root))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != test.want {
+			t.Errorf("evalJSONPath(%q) = %s, want %s", test.expr, data, test.want)
+		}
+	}
+}
+
+func TestExecuteJSONPath(t *testing.T) {
+	root := decodeDoc(t, `[{"id": "web", "instances": 2}, {"id": "api", "instances": 1, "state": "normal"}]`)
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{[*].id}", "web api"},
+		{`{range [*]}{.id}={.instances}{"\n"}{end}`, "web=2\napi=1\n"},
+		{`{range [*]}{.id}:{.state};{end}`, "web:;api:normal;"},
+		{"{$[1]}", `{"id":"api","instances":1,"state":"normal"}`},
+	}
+
+	for _, test := range tests {
+		nodes, err := parseJSONPath(test.template)
+		if err != nil {
+			t.Fatalf("parseJSONPath(%q) failed: %s", test.template, err)
+		}
+
+		var buf bytes.Buffer
+		if err := executeJSONPath(&buf, nodes, root, root); err != nil {
+			t.Errorf("executeJSONPath(%q) failed: %s", test.template, err)
+			continue
+		}
+
+		if buf.String() != test.want {
+			t.Errorf("executeJSONPath(%q) = %q, want %q", test.template, buf.String(), test.want)
+		}
+	}
+}
+
+// decodeDoc decodes data like outputDoc does, keeping numbers as
+// json.Number.
+func decodeDoc(t *testing.T, data string) interface{} {
+	var doc interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func nodesString(nodes []*jsonpathNode) string {
+	data, _ := json.Marshal(nodesDoc(nodes))
+	return string(data)
+}
+
+func nodesDoc(nodes []*jsonpathNode) []interface{} {
+	var doc []interface{}
+	for _, node := range nodes {
+		doc = append(doc, map[string]interface{}{
+			"text":   node.text,
+			"path":   node.path,
+			"ranged": node.ranged,
+			"body":   nodesDoc(node.body),
+		})
+	}
+
+	return doc
+}
@@ -0,0 +1,262 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// NewPromoteCommand returns the CLI command for "promote"
+func NewPromoteCommand() cli.Command {
+	return cli.Command{
+		Name:      "promote",
+		Usage:     "deploy the spec of an application to another cluster, with overrides",
+		ArgsUsage: "[app-id]",
+		Description: "Overrides are a partial spec. Labels, env and other objects are merged\n" +
+			"   into the live spec key by key, a null value removes a key; lists and\n" +
+			"   values replace the live ones. The source app isn't changed.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "Cluster to deploy the application to [CLUSTER]",
+			},
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster the application runs in [CLUSTER]",
+			},
+			cli.StringFlag{
+				Name:  "overrides",
+				Usage: "Override the spec with `FILE`, or with CLUSTER.yaml, .yml, .json or .toml of a directory",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the diff without deploying",
+			},
+			cli.BoolFlag{
+				Name:  "yes, y",
+				Usage: "Deploy without asking for confirmation",
+			},
+			cli.BoolFlag{
+				Name:  "no-color",
+				Usage: "Don't colorize the diff",
+			},
+			cli.BoolFlag{
+				Name:  "disable-quota",
+				Usage: "Disable quota check",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: 2 * time.Minute,
+				Usage: "Time to wait for the application in the target cluster",
+			},
+		}, templateFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := promoteApplication(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// promoteApplication executes the "promote" command.
+func promoteApplication(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("App ID required")
+	}
+
+	appId, to := c.Args()[0], c.String("to")
+	if to == "" {
+		return fmt.Errorf("target cluster required, set it with --to")
+	}
+
+	source, err := appClient(appId, c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	app, err := source.GetApp(context.Background(), appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return fmt.Errorf("app %s not found", appId)
+		}
+		return err
+	}
+
+	if app.CurrentVersion == nil {
+		return fmt.Errorf("current version of %s unknown, can't promote it", appId)
+	}
+
+	spec := liveSpec(app)
+	if path := c.String("overrides"); path != "" {
+		vars, err := specVars(c)
+		if err != nil {
+			return err
+		}
+
+		if spec, err = overrideSpec(spec, path, to, vars); err != nil {
+			return err
+		}
+	}
+	spec.Cluster = to
+
+	if specAppID(spec) == appId {
+		return fmt.Errorf("app %s already runs in cluster %s", appId, to)
+	}
+
+	step := &applyStep{AppId: specAppID(spec), Cluster: to, Spec: spec}
+	plan := &applyPlan{Steps: []*applyStep{step}, clients: make(map[string]*client.Client)}
+	if err := plan.diff(false, nil); err != nil {
+		return err
+	}
+
+	if step.Action == applyUnchanged {
+		fmt.Printf("No changes, %s in cluster:%s is up to date.\n", step.AppId, to)
+		return nil
+	}
+
+	live := &types.Spec{}
+	if step.App != nil {
+		live = liveSpec(step.App)
+	}
+
+	from, desired, err := normalizeSpecs(live, spec, nil)
+	if err != nil {
+		return err
+	}
+
+	fromName := "live/" + step.AppId
+	if step.App == nil {
+		from, fromName = nil, "/dev/null"
+	}
+
+	fmt.Printf("===> promoting %s to %s (%s)\n", appId, step.AppId, step.Action)
+	lines := unifiedDiff(from, desired, fromName, "promoted/"+step.AppId)
+	printDiff(os.Stdout, lines, !c.Bool("no-color") && isTerminal(os.Stdout))
+
+	if c.Bool("dry-run") {
+		return nil
+	}
+
+	if !c.Bool("yes") && !confirm(fmt.Sprintf("Do you want to %s %s?", step.Action, step.AppId)) {
+		return fmt.Errorf("promote cancelled")
+	}
+
+	return plan.apply(step, c.Bool("disable-quota"), c.Duration("wait"))
+}
+
+// overrideSpec merges the override file at path into spec. When path is
+// a directory, the file named after the target cluster is used.
+func overrideSpec(spec *types.Spec, path, cluster string, vars map[string]string) (*types.Spec, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		file, err := clusterOverrides(path, cluster)
+		if err != nil {
+			return nil, err
+		}
+		path = file
+	}
+
+	overrides, err := readSpec(path, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the shape of the overrides is checked here, the merged spec is
+	// validated as a whole below.
+	v := &specValidator{}
+	v.checkDoc("$", overrides.Doc, reflect.TypeOf(types.Spec{}))
+	if len(v.problems) > 0 {
+		fmt.Fprintf(os.Stderr, "===> validating %s...\n", overrides.Name())
+		printProblems(os.Stderr, v.problems)
+	}
+	if hasErrors(v.problems) {
+		return nil, fmt.Errorf("Overrides %s are invalid", overrides.Name())
+	}
+
+	doc, err := specDoc(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &specFile{Path: path, Doc: mergeDoc("", doc, overrides.Doc)}
+	problems := validateSpec(merged)
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "===> validating %s merged with %s...\n", spec.AppName, overrides.Name())
+		printProblems(os.Stderr, problems)
+	}
+	if hasErrors(problems) {
+		return nil, fmt.Errorf("Spec merged with %s is invalid", overrides.Name())
+	}
+
+	return merged.Spec()
+}
+
+// clusterOverrides returns the override file of cluster in dir.
+func clusterOverrides(dir, cluster string) (string, error) {
+	for _, ext := range []string{".yaml", ".yml", ".json", ".toml"} {
+		file := filepath.Join(dir, cluster+ext)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+
+	return "", fmt.Errorf("no overrides for cluster %s in %s", cluster, dir)
+}
+
+// mergeDoc merges the override document into the spec document base.
+// Objects are merged key by key, matching field names like encoding/json
+// and the keys of labels and env exactly; a null removes a key. Anything
+// else in overrides replaces the value of base.
+func mergeDoc(path string, base, overrides interface{}) interface{} {
+	o, ok := overrides.(map[string]interface{})
+	if !ok {
+		return overrides
+	}
+
+	b, ok := base.(map[string]interface{})
+	if !ok {
+		return overrides
+	}
+
+	data := path == "Labels" || path == "Env"
+
+	m := make(map[string]interface{}, len(b)+len(o))
+	for key, val := range b {
+		m[key] = val
+	}
+
+	for key, val := range o {
+		name := key
+		if !data {
+			for k := range b {
+				if strings.EqualFold(k, key) {
+					name = k
+					break
+				}
+			}
+		}
+
+		if val == nil {
+			delete(m, name)
+			continue
+		}
+
+		m[name] = mergeDoc(name, m[name], val)
+	}
+
+	return m
+}
@@ -0,0 +1,321 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// NewProxyCommand returns the CLI command for "proxy"
+func NewProxyCommand() cli.Command {
+	return cli.Command{
+		Name:  "proxy",
+		Usage: "serve swan through a proxy enforcing quotas",
+		Description: "Forwards every request to the swan of a context. Creating, updating and\n" +
+			"   scaling apps is only forwarded when it fits in the quota of the user,\n" +
+			"   otherwise it is rejected with 403.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "listen, l",
+				Value: "127.0.0.1:9990",
+				Usage: "Address the proxy listens on",
+			},
+			cli.StringFlag{
+				Name:  "context",
+				Usage: "Context of the swan to forward to, the current one by default",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := runProxy(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// runProxy executes the "proxy" command.
+func runProxy(c *cli.Context) error {
+	cluster, err := getCluster(c.String("context"))
+	if err != nil {
+		return err
+	}
+
+	if cluster.Swan == "" {
+		return fmt.Errorf("swan address of context %s not set", cluster.Name)
+	}
+
+	p, err := newAdmissionProxy(cluster)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("proxying %s for cluster %s on %s", cluster.Swan, cluster.Name, c.String("listen"))
+
+	return http.ListenAndServe(c.String("listen"), p)
+}
+
+// admissionProxy forwards requests to swan, checking those which make
+// apps use more resources against the quotas in the store first.
+type admissionProxy struct {
+	cluster *Cluster
+	swan    *client.Client
+	forward *httputil.ReverseProxy
+
+	// mu serializes admitted changes, so that two requests can't both fit
+	// in what is left of a quota.
+	mu sync.Mutex
+}
+
+func newAdmissionProxy(cluster *Cluster) (*admissionProxy, error) {
+	target, err := url.Parse(cluster.Swan)
+	if err != nil {
+		return nil, fmt.Errorf("invalid swan address %q: %s", cluster.Swan, err.Error())
+	}
+
+	return &admissionProxy{
+		cluster: cluster,
+		swan:    newClient(cluster),
+		forward: httputil.NewSingleHostReverseProxy(target),
+	}, nil
+}
+
+// quotaRejection is the body of a 403 answered to a request exceeding a
+// quota. Error holds the message swan clients print.
+type quotaRejection struct {
+	Error     string           `json:"error"`
+	User      string           `json:"user"`
+	Cluster   string           `json:"cluster"`
+	Exceeded  []string         `json:"exceeded,omitempty"`
+	Resources []*quotaResource `json:"resources,omitempty"`
+}
+
+type quotaResource struct {
+	Name  string   `json:"name"`
+	Quota *float64 `json:"quota"`
+	Used  *float64 `json:"used,omitempty"`
+	Need  float64  `json:"need"`
+}
+
+func (p *admissionProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 0 || parts[0] != "apps" {
+		p.forward.ServeHTTP(w, r)
+		return
+	}
+
+	var admit func([]byte) (*quotaRejection, error)
+	switch {
+	case r.Method == "POST" && len(parts) == 1:
+		admit = p.admitCreate
+	case r.Method == "PUT" && len(parts) == 2:
+		admit = func(body []byte) (*quotaRejection, error) { return p.admitUpdate(parts[1], body) }
+	case r.Method == "PATCH" && len(parts) == 3 && parts[2] == "scale":
+		admit = func(body []byte) (*quotaRejection, error) { return p.admitScale(parts[1], body) }
+	default:
+		p.forward.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read request failed: %s", err.Error()))
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rejection, err := admit(body)
+	if err != nil {
+		log.Printf("%s %s: %s", r.Method, r.URL.Path, err.Error())
+		writeError(w, admissionStatus(err), err.Error())
+		return
+	}
+
+	if rejection != nil {
+		log.Printf("%s %s rejected: %s", r.Method, r.URL.Path, rejection.Error)
+		writeJSON(w, http.StatusForbidden, rejection)
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	p.forward.ServeHTTP(w, r)
+}
+
+// admitCreate checks a new app against the quota of its user.
+func (p *admissionProxy) admitCreate(body []byte) (*quotaRejection, error) {
+	spec := &types.Spec{}
+	if err := json.Unmarshal(body, spec); err != nil {
+		return nil, badRequest("invalid spec: %s", err.Error())
+	}
+
+	need := specNeed(spec, int(spec.Instances))
+	need.Apps = 1
+
+	return p.check(spec.RunAs, need)
+}
+
+// admitUpdate checks what a new version of an app uses beyond the current
+// one. The quota is the one of the user the app runs as.
+func (p *admissionProxy) admitUpdate(appId string, body []byte) (*quotaRejection, error) {
+	spec := &types.Spec{}
+	if err := json.Unmarshal(body, spec); err != nil {
+		return nil, badRequest("invalid spec: %s", err.Error())
+	}
+
+	app, err := p.swan.GetApp(context.Background(), appId)
+	if err != nil {
+		// Let swan answer for apps it doesn't know.
+		if client.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	instances := int(spec.Instances)
+	if instances == 0 {
+		instances = app.Instances
+	}
+
+	need := specNeed(spec, instances)
+	need.subtract(specNeed(liveSpec(app), app.Instances))
+
+	return p.check(app.RunAs, need)
+}
+
+// admitScale checks the instances added to an app.
+func (p *admissionProxy) admitScale(appId string, body []byte) (*quotaRejection, error) {
+	var scale struct {
+		Instances *int `json:"instances"`
+	}
+	if err := json.Unmarshal(body, &scale); err != nil || scale.Instances == nil {
+		return nil, badRequest("instances required")
+	}
+
+	app, err := p.swan.GetApp(context.Background(), appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	delta := *scale.Instances - app.Instances
+	if delta <= 0 {
+		return nil, nil
+	}
+
+	spec := app.CurrentVersion
+	if spec == nil {
+		return nil, fmt.Errorf("current version of %s unknown, can't check quota", appId)
+	}
+
+	return p.check(app.RunAs, specNeed(spec, delta))
+}
+
+// check runs the arithmetic of checkQuotaFor in the proxied cluster and
+// describes the dimensions need doesn't fit in, if any. Whatever cluster a
+// request names, it is served by the proxied swan.
+func (p *admissionProxy) check(user string, need *quotaNeed) (*quotaRejection, error) {
+	if user == "" {
+		return nil, badRequest("runAs required")
+	}
+
+	cluster := p.cluster.Name
+
+	quota, err := getQuota(user, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("calculate quota got error: %s", err.Error())
+	}
+
+	if quota == nil {
+		return &quotaRejection{
+			Error:   fmt.Sprintf("No quota found for %s in %s", user, cluster),
+			User:    user,
+			Cluster: cluster,
+		}, nil
+	}
+
+	// Usage is always fetched fresh from the proxied swan, and counts what
+	// apps declare: tasks of apps admitted a moment ago may not run yet.
+	usage, err := fetchDeclaredUsage(p.swan, userFilter(user))
+	if err != nil {
+		return nil, err
+	}
+	used := usage.user(user)
+
+	exceeded := exceededDimensions(quota, used, need)
+	if len(exceeded) == 0 {
+		return nil, nil
+	}
+
+	rejection := &quotaRejection{
+		Error:    fmt.Sprintf("Quota exceed: %s", strings.Join(exceeded, ", ")),
+		User:     user,
+		Cluster:  cluster,
+		Exceeded: exceeded,
+	}
+	for _, d := range quotaDimensions {
+		resource := &quotaResource{Name: d.Name, Need: d.need(need)}
+		if d.limited(quota) {
+			limit := d.limit(quota)
+			resource.Quota = &limit
+		}
+		if d.total {
+			u := d.used(used)
+			resource.Used = &u
+		}
+		rejection.Resources = append(rejection.Resources, resource)
+	}
+
+	return rejection, nil
+}
+
+// badRequestError is an admission failure caused by the request itself.
+type badRequestError string
+
+func (e badRequestError) Error() string {
+	return string(e)
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return badRequestError(fmt.Sprintf(format, a...))
+}
+
+// admissionStatus is the status answered when a request couldn't be
+// checked. Quotas are only a guarantee when such requests aren't
+// forwarded.
+func admissionStatus(err error) int {
+	if _, ok := err.(badRequestError); ok {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusBadGateway
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
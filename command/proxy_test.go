@@ -0,0 +1,197 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Dataman-Cloud/swancfg/types"
+)
+
+// fakeSwan serves the app routes the proxy uses. Apps are created without
+// tasks, like swan does before mesos launches them.
+type fakeSwan struct {
+	mu       sync.Mutex
+	apps     map[string]*types.App
+	requests []string
+}
+
+func (s *fakeSwan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "apps" {
+		writeError(w, http.StatusNotFound, "no route")
+		return
+	}
+
+	if r.Method != "GET" {
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	}
+
+	var app *types.App
+	if len(parts) > 1 {
+		app = s.apps[parts[1]]
+		if app == nil {
+			writeError(w, http.StatusNotFound, "app not found")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == "GET" && len(parts) == 1:
+		var apps []*types.App
+		for _, app := range s.apps {
+			listed := *app
+			listed.CurrentVersion = nil
+			apps = append(apps, &listed)
+		}
+		writeJSON(w, http.StatusOK, apps)
+	case r.Method == "GET" && len(parts) == 2:
+		writeJSON(w, http.StatusOK, app)
+	case r.Method == "POST" && len(parts) == 1:
+		spec := &types.Spec{}
+		json.NewDecoder(r.Body).Decode(spec)
+		id := specAppID(spec)
+		s.apps[id] = &types.App{ID: id, Name: spec.AppName, RunAs: spec.RunAs, Instances: int(spec.Instances), CurrentVersion: spec}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	case r.Method == "PUT" && len(parts) == 2:
+		spec := &types.Spec{}
+		json.NewDecoder(r.Body).Decode(spec)
+		app.CurrentVersion = spec
+		if spec.Instances > 0 {
+			app.Instances = int(spec.Instances)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": app.ID})
+	case r.Method == "PATCH" && len(parts) == 3 && parts[2] == "scale":
+		var scale struct{ Instances int }
+		json.NewDecoder(r.Body).Decode(&scale)
+		app.Instances = scale.Instances
+		writeJSON(w, http.StatusOK, map[string]string{"id": app.ID})
+	default:
+		writeError(w, http.StatusNotFound, "no route")
+	}
+}
+
+// forwarded returns how many requests changing apps swan got.
+func (s *fakeSwan) forwarded() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+func TestAdmissionProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swancfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(path string) { storePath = path }(storePath)
+	storePath = filepath.Join(dir, "swancfg.db")
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.ChangeQuotas([]*types.QuotaChange{
+		{User: "alice", Cluster: "test", After: &types.Quota{Cpu: 1, Memory: 512}},
+		{User: "alice", Cluster: "other", After: &types.Quota{Cpu: 100, Memory: 10000}},
+		{User: "bob", Cluster: "test", After: &types.Quota{Cpu: 100, Memory: 10000}},
+	})
+	store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swan := &fakeSwan{apps: make(map[string]*types.App)}
+	swanServer := httptest.NewServer(swan)
+	defer swanServer.Close()
+
+	p, err := newAdmissionProxy(&Cluster{Name: "test", Swan: swanServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	spec := func(name, runAs, cluster string, cpus float64, instances int) string {
+		return fmt.Sprintf(`{"appName":%q,"runAs":%q,"cluster":%q,"cpus":%g,"mem":64,"instances":%d}`,
+			name, runAs, cluster, cpus, instances)
+	}
+
+	// Every step runs against what the previous ones left in swan.
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		exceeded string
+	}{
+		{"create fits", "POST", "/apps", spec("web", "alice", "test", 0.25, 2), 201, ""},
+		{"create fits the rest", "POST", "/apps", spec("api", "alice", "test", 0.25, 2), 201, ""},
+		{"create counts apps without tasks", "POST", "/apps", spec("db", "alice", "test", 0.25, 1), 403, "cpu"},
+		{"create checks the proxied cluster", "POST", "/apps", spec("db", "alice", "other", 0.25, 1), 403, "cpu"},
+		{"create without runAs", "POST", "/apps", spec("db", "", "test", 0.25, 1), 400, ""},
+		{"update growing", "PUT", "/apps/web-alice-test", spec("web", "alice", "test", 0.5, 2), 403, "cpu"},
+		{"update runs as the live user", "PUT", "/apps/web-alice-test", spec("web", "bob", "test", 0.5, 2), 403, "cpu"},
+		{"update not growing", "PUT", "/apps/web-alice-test", spec("web", "alice", "test", 0.25, 2), 200, ""},
+		{"update of unknown app", "PUT", "/apps/nope-alice-test", spec("nope", "alice", "test", 0.25, 2), 404, ""},
+		{"scale up", "PATCH", "/apps/web-alice-test/scale", `{"instances":3}`, 403, "cpu"},
+		{"scale down", "PATCH", "/apps/api-alice-test/scale", `{"instances":1}`, 200, ""},
+		{"scale up into freed quota", "PATCH", "/apps/web-alice-test/scale", `{"instances":3}`, 200, ""},
+		{"scale up again", "PATCH", "/apps/web-alice-test/scale", `{"instances":4}`, 403, "cpu"},
+		{"scale without instances", "PATCH", "/apps/web-alice-test/scale", `{}`, 400, ""},
+	}
+
+	for _, step := range steps {
+		before := swan.forwarded()
+
+		req, err := http.NewRequest(step.method, proxy.URL+step.path, strings.NewReader(step.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != step.status {
+			t.Errorf("%s: got status %d, want %d: %s", step.name, resp.StatusCode, step.status, body)
+			continue
+		}
+
+		forwarded := swan.forwarded() > before
+		if admitted := step.status != 403 && step.status != 400; forwarded != admitted {
+			t.Errorf("%s: forwarded to swan is %t, want %t", step.name, forwarded, admitted)
+		}
+
+		if step.status != 403 {
+			continue
+		}
+
+		rejection := &quotaRejection{}
+		if err := json.Unmarshal(body, rejection); err != nil {
+			t.Errorf("%s: invalid rejection %s: %s", step.name, body, err)
+			continue
+		}
+		if rejection.User != "alice" || rejection.Cluster != "test" {
+			t.Errorf("%s: rejected for %s in %s, want alice in test", step.name, rejection.User, rejection.Cluster)
+		}
+		if strings.Join(rejection.Exceeded, ",") != step.exceeded {
+			t.Errorf("%s: exceeded %v, want %s", step.name, rejection.Exceeded, step.exceeded)
+		}
+	}
+}
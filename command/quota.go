@@ -1,16 +1,36 @@
 package command
 
 import (
-	"encoding/json"
+	"encoding/csv"
 	"fmt"
-	"net/http"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Dataman-Cloud/swancfg/types"
-	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
 )
 
+// legacyQuotaFile is where quotas were kept before the store, relative to
+// the working directory.
+const legacyQuotaFile = "quota.yml"
+
+// Quota formats for import and export.
+const (
+	quotaFormatYAML = "yaml"
+	quotaFormatCSV  = "csv"
+)
+
+// Quota holds quotas by user, then by cluster.
+type Quota map[string]map[string]*types.Quota
+
 func NewQuotaCommand() cli.Command {
 	return cli.Command{
 		Name:  "quota",
@@ -19,147 +39,654 @@ func NewQuotaCommand() cli.Command {
 			cli.Command{
 				Name:  "list",
 				Usage: "show quota",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{
 						Name:  "user",
 						Usage: "list quota for user [USER]",
 					},
-				},
+				}, append(selectorFlags(), outputFlags()...)...),
 				Action: func(c *cli.Context) {
 					if err := listQuota(c); err != nil {
 						fmt.Fprintln(os.Stderr, "Error:", err)
 					}
 				},
 			},
+			cli.Command{
+				Name:      "set",
+				Usage:     "set quota of user in cluster",
+				ArgsUsage: "[user] [cluster]",
+				Flags:     quotaFlags(),
+				Action: func(c *cli.Context) {
+					if err := setQuota(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:      "remove",
+				Usage:     "remove quota of user in cluster",
+				ArgsUsage: "[user] [cluster]",
+				Action: func(c *cli.Context) {
+					if err := removeQuota(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:      "import",
+				Usage:     "import quotas from yaml or csv file",
+				ArgsUsage: "[file]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of the file, yaml or csv, detected from its extension by default",
+					},
+					cli.BoolFlag{
+						Name:  "replace",
+						Usage: "Remove the quotas missing from the file",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if err := importQuotas(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:  "export",
+				Usage: "export quotas to yaml or csv",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format",
+						Value: quotaFormatYAML,
+						Usage: "Format of the export, yaml or csv",
+					},
+					cli.StringFlag{
+						Name:  "file, f",
+						Usage: "Write the export to `FILE` instead of stdout",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if err := exportQuotas(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
+			cli.Command{
+				Name:  "history",
+				Usage: "show who changed quotas and when",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "user",
+						Usage: "show changes of quotas of user [USER]",
+					},
+					cli.StringFlag{
+						Name:  "cluster",
+						Usage: "show changes of quotas in cluster [CLUSTER]",
+					},
+				}, outputFlags()...),
+				Action: func(c *cli.Context) {
+					if err := listQuotaHistory(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+				},
+			},
 		},
 	}
 }
 
+// quotaListItem is a quota with what is used of it.
+type quotaListItem struct {
+	User    string       `json:"user"`
+	Cluster string       `json:"cluster"`
+	Quota   *types.Quota `json:"quota"`
+	Used    *usage       `json:"used"`
+}
+
 func listQuota(c *cli.Context) error {
-	if c.String("user") != "" {
-		return listQuotaForUser(c.String("user"))
+	p, err := newPrinter(c)
+	if err != nil {
+		return err
 	}
 
-	return listQuotaForAll()
-}
+	filter, err := newAppFilter(c)
+	if err != nil {
+		return err
+	}
 
-func listQuotaForUser(user string) error {
 	quota, err := getQuotas()
 	if err != nil {
 		return err
 	}
 
-	if c, ok := quota[user]; ok {
-		printSingleQuota(c, user)
+	user := c.String("user")
+	if user != "" {
+		quota = Quota{user: quota[user]}
+		if quota[user] == nil {
+			quota = Quota{}
+		}
 	}
 
+	// The field selector picks quotas by user and cluster, and with the
+	// label selector which apps count as used.
+	for u, clusters := range quota {
+		for cluster := range clusters {
+			if !filter.matchesField("runAs", u) || !filter.matchesField("cluster", cluster) {
+				delete(clusters, cluster)
+			}
+		}
+		if len(clusters) == 0 {
+			delete(quota, u)
+		}
+	}
+
+	usage := aggregateUsage(quota.clusters(), filter)
+
+	items := []*quotaListItem{}
+	for _, u := range quota.users() {
+		for _, cluster := range sortedKeys(quota[u]) {
+			used, err := usage.used(u, cluster)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "calculating resource error: %s\n", err.Error())
+			}
+			items = append(items, &quotaListItem{
+				User:    u,
+				Cluster: cluster,
+				Quota:   quota[u][cluster],
+				Used:    used,
+			})
+		}
+	}
+
+	return p.print(quotaTable(items, user == ""), items)
+}
+
+// quotaTable lists quotas, with the user column when they aren't all of
+// the same user.
+func quotaTable(items []*quotaListItem, users bool) *outputTable {
+	header := append([]string{"CLUSTER"}, quotaHeader()...)
+	if users {
+		header = append([]string{"USER"}, header...)
+	}
+
+	t := newOutputTable(header...)
+	t.rowLine = true
+	for _, item := range items {
+		row := append([]string{item.Cluster}, quotaRow(item.Quota, item.Used)...)
+		if users {
+			row = append([]string{item.User}, row...)
+		}
+		t.append(row...)
+	}
+
+	return t
+}
+
+// getQuotas returns every quota from the store.
+func getQuotas() (Quota, error) {
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return store.ListQuotas()
+}
+
+func (q Quota) users() []string {
+	users := make([]string, 0, len(q))
+	for user := range q {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	return users
+}
+
+// clusters returns every cluster some user has a quota in.
+func (q Quota) clusters() []string {
+	seen := make(map[string]bool)
+	var clusters []string
+	for _, user := range q {
+		for cluster := range user {
+			if !seen[cluster] {
+				seen[cluster] = true
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+	sort.Strings(clusters)
+
+	return clusters
+}
+
+func sortedKeys(quotas map[string]*types.Quota) []string {
+	keys := make([]string, 0, len(quotas))
+	for key := range quotas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// setQuota executes the "quota set" command.
+func setQuota(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return fmt.Errorf("User and cluster required")
+	}
+
+	var set bool
+	for _, d := range quotaDimensions {
+		set = set || c.IsSet(d.Flag)
+	}
+	if !set {
+		return fmt.Errorf("at least one limit required, see swancfg quota set --help")
+	}
+
+	user, cluster := c.Args()[0], c.Args()[1]
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	quota, err := store.GetQuota(user, cluster)
+	if err != nil {
+		return err
+	}
+
+	if quota == nil {
+		if !c.IsSet("cpu") || !c.IsSet("mem") {
+			return fmt.Errorf("both --cpu and --mem required for a new quota")
+		}
+		quota = &types.Quota{}
+	}
+
+	for _, d := range quotaDimensions {
+		if !c.IsSet(d.Flag) {
+			continue
+		}
+
+		v := c.Float64(d.Flag)
+		if d.integer {
+			v = float64(c.Int(d.Flag))
+		}
+		d.set(quota, v)
+	}
+
+	if !validQuota(quota) {
+		return fmt.Errorf("quota must not be negative")
+	}
+
+	change := newQuotaChange("set", user, cluster, quota)
+	if err := store.ChangeQuotas([]*types.QuotaChange{change}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Quota of %s in %s set to %s\n", user, cluster, formatQuota(quota))
 	return nil
+}
 
+// removeQuota executes the "quota remove" command.
+func removeQuota(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return fmt.Errorf("User and cluster required")
+	}
+
+	user, cluster := c.Args()[0], c.Args()[1]
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	quota, err := store.GetQuota(user, cluster)
+	if err != nil {
+		return err
+	}
+
+	if quota == nil {
+		return fmt.Errorf("no quota for %s in %s", user, cluster)
+	}
+
+	change := newQuotaChange("remove", user, cluster, nil)
+	if err := store.ChangeQuotas([]*types.QuotaChange{change}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Quota of %s in %s removed\n", user, cluster)
+	return nil
 }
 
-func printSingleQuota(quota map[string]*types.Quota, user string) {
-	tb := tablewriter.NewWriter(os.Stdout)
-	tb.SetHeader([]string{
-		"CLUSTER",
-		"CPU",
-		"USED",
-		"MEMORY",
-		"USED",
-	})
-	for cluster, q := range quota {
-		cpuUsed, memUsed, err := getUsedQuota(user, cluster)
+// importQuotas executes the "quota import" command.
+func importQuotas(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("File required")
+	}
+
+	path := c.Args()[0]
+	format := c.String("format")
+	if format == "" {
+		format = quotaFormatYAML
+		if strings.ToLower(filepath.Ext(path)) == ".csv" {
+			format = quotaFormatCSV
+		}
+	}
+
+	quotas, err := readQuotaFile(path, format)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var changes []*types.QuotaChange
+	for _, user := range quotas.users() {
+		for _, cluster := range sortedKeys(quotas[user]) {
+			changes = append(changes, newQuotaChange("import", user, cluster, quotas[user][cluster]))
+		}
+	}
+
+	var removed int
+	if c.Bool("replace") {
+		current, err := store.ListQuotas()
 		if err != nil {
-			fmt.Printf("calculating resource error: %s\n", err.Error())
+			return err
+		}
+
+		for _, user := range current.users() {
+			for _, cluster := range sortedKeys(current[user]) {
+				if quotas[user][cluster] == nil {
+					changes = append(changes, newQuotaChange("import", user, cluster, nil))
+					removed++
+				}
+			}
 		}
-		tb.Append([]string{
-			cluster,
-			fmt.Sprintf("%.2f", q.Cpu),
-			fmt.Sprintf("%.2f", cpuUsed),
-			fmt.Sprintf("%.2f", q.Memory),
-			fmt.Sprintf("%.2f", memUsed),
-		})
 	}
-	tb.SetRowLine(true)
-	tb.Render()
+
+	if err := store.ChangeQuotas(changes); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d quota(s) from %s, removed %d\n", len(changes)-removed, path, removed)
+	return nil
 }
 
-func listQuotaForAll() error {
-	quota, err := getQuotas()
+// exportQuotas executes the "quota export" command.
+func exportQuotas(c *cli.Context) error {
+	quotas, err := getQuotas()
 	if err != nil {
 		return err
 	}
 
-	printAllQuota(quota)
+	w := io.Writer(os.Stdout)
+	if path := c.String("file"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
 
-	return nil
+	switch c.String("format") {
+	case quotaFormatYAML:
+		data, err := yaml.Marshal(quotas)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case quotaFormatCSV:
+		cw := csv.NewWriter(w)
+		header := []string{"user", "cluster"}
+		for _, d := range quotaDimensions {
+			header = append(header, d.Name)
+		}
+		cw.Write(header)
+
+		for _, user := range quotas.users() {
+			for _, cluster := range sortedKeys(quotas[user]) {
+				record := []string{user, cluster}
+				for _, d := range quotaDimensions {
+					record = append(record, strconv.FormatFloat(d.limit(quotas[user][cluster]), 'f', -1, 64))
+				}
+				cw.Write(record)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return fmt.Errorf("unknown format %q, expected yaml or csv", c.String("format"))
 }
 
-func printAllQuota(quota Quota) {
-	tb := tablewriter.NewWriter(os.Stdout)
-	tb.SetHeader([]string{
-		"USER",
-		"CLUSTER",
-		"CPU",
-		"USED",
-		"MEMORY",
-		"USED",
-	})
-	for user, cluster := range quota {
-		for c, q := range cluster {
-			cpuUsed, memUsed, err := getUsedQuota(user, c)
-			if err != nil {
-				fmt.Printf("calculating resource error: %s\n", err.Error())
+// readQuotaFile reads quotas in the quota.yml layout, or as csv rows of
+// user, cluster and every limit with an optional header.
+func readQuotaFile(path, format string) (Quota, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Read quota file failed: %s", err.Error())
+	}
+
+	quotas := make(Quota)
+	switch format {
+	case quotaFormatYAML:
+		if err := yaml.Unmarshal(file, &quotas); err != nil {
+			return nil, fmt.Errorf("Unmarshal %s error: %s", path, err.Error())
+		}
+	case quotaFormatCSV:
+		records, err := csv.NewReader(strings.NewReader(string(file))).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshal %s error: %s", path, err.Error())
+		}
+
+		for i, record := range records {
+			// Files exported before the other limits only have cpu and
+			// memory.
+			if len(record) != 4 && len(record) != 2+len(quotaDimensions) {
+				return nil, fmt.Errorf("%s line %d: expected user,cluster,%s", path, i+1, strings.Join(quotaDimensionNames(), ","))
 			}
-			tb.Append([]string{
-				user,
-				c,
-				fmt.Sprintf("%.2f", q.Cpu),
-				fmt.Sprintf("%.2f", cpuUsed),
-				fmt.Sprintf("%.2f", q.Memory),
-				fmt.Sprintf("%.2f", memUsed),
-			})
 
+			if i == 0 && record[0] == "user" {
+				continue
+			}
+
+			q := &types.Quota{}
+			for j, d := range quotaDimensions[:len(record)-2] {
+				v, err := d.parse(strings.TrimSpace(record[2+j]))
+				if err != nil {
+					return nil, fmt.Errorf("%s line %d: %s", path, i+1, err.Error())
+				}
+				d.set(q, v)
+			}
+
+			user, cluster := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+			if quotas[user] == nil {
+				quotas[user] = make(map[string]*types.Quota)
+			}
+			quotas[user][cluster] = q
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected yaml or csv", format)
+	}
+
+	for user, clusters := range quotas {
+		for cluster, q := range clusters {
+			if !validQuota(q) {
+				return nil, fmt.Errorf("invalid quota of %s in %s", user, cluster)
+			}
 		}
 	}
-	tb.SetRowLine(true)
-	tb.Render()
 
+	return quotas, nil
 }
 
-func getUsedQuota(user, cluster string) (float64, float64, error) {
-	addr, err := getClusterAddr(cluster)
+// listQuotaHistory executes the "quota history" command.
+func listQuotaHistory(c *cli.Context) error {
+	p, err := newPrinter(c)
 	if err != nil {
-		return 0, 0, fmt.Errorf("Cluster can't be found. %s", err.Error())
+		return err
 	}
 
-	if addr == "" {
-		return 0, 0, fmt.Errorf("Cluster address can't be found. %s", cluster)
+	store, err := openStore()
+	if err != nil {
+		return err
 	}
+	defer store.Close()
 
-	resp, err := http.Get(fmt.Sprintf("%s/apps?fields=runAs==%s", addr, user))
+	changes, err := store.QuotaHistory()
 	if err != nil {
-		return 0, 0, fmt.Errorf("Get apps failed: %s", err.Error())
+		return err
+	}
+
+	var matched []*types.QuotaChange
+	t := newOutputTable(
+		"TIME",
+		"WHO",
+		"ACTION",
+		"USER",
+		"CLUSTER",
+		"CHANGES",
+	)
+	t.wrap = false
+	for _, change := range changes {
+		if c.String("user") != "" && change.User != c.String("user") {
+			continue
+		}
+		if c.String("cluster") != "" && change.Cluster != c.String("cluster") {
+			continue
+		}
+
+		matched = append(matched, change)
+		t.append(
+			change.Time.Local().Format("2006-01-02 15:04:05"),
+			change.Who,
+			change.Action,
+			change.User,
+			change.Cluster,
+			quotaChanges(change.Before, change.After),
+		)
+	}
+
+	return p.print(t, matched)
+}
+
+// quotaChanges describes the limits which differ between before and
+// after.
+func quotaChanges(before, after *types.Quota) string {
+	var changes []string
+	for _, d := range quotaDimensions {
+		from, to := d.formatLimit(before), d.formatLimit(after)
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", d.Name, from, to))
+		}
+	}
+
+	return strings.Join(changes, ", ")
+}
+
+// formatQuota describes the limits of q.
+func formatQuota(q *types.Quota) string {
+	var limits []string
+	for _, d := range quotaDimensions {
+		if d.limited(q) {
+			limits = append(limits, fmt.Sprintf("%s: %s", d.Name, d.format(d.limit(q))))
+		}
+	}
+
+	return strings.Join(limits, " ")
+}
+
+// quotaFlags returns a flag for every limit of a quota.
+func quotaFlags() []cli.Flag {
+	var flags []cli.Flag
+	for _, d := range quotaDimensions {
+		if d.integer {
+			flags = append(flags, cli.IntFlag{Name: d.Flag, Usage: d.Usage})
+		} else {
+			flags = append(flags, cli.Float64Flag{Name: d.Flag, Usage: d.Usage})
+		}
+	}
+
+	return flags
+}
+
+func quotaDimensionNames() []string {
+	var names []string
+	for _, d := range quotaDimensions {
+		names = append(names, d.Name)
+	}
+
+	return names
+}
+
+func newQuotaChange(action, user, cluster string, quota *types.Quota) *types.QuotaChange {
+	return &types.QuotaChange{
+		Time:    time.Now(),
+		Who:     whoami(),
+		Action:  action,
+		User:    user,
+		Cluster: cluster,
+		After:   quota,
+	}
+}
+
+// whoami returns the name of the local user running swancfg, which is
+// recorded in the quota history.
+func whoami() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+
+	if name := os.Getenv("USER"); name != "" {
+		return name
 	}
-	defer resp.Body.Close()
 
-	var apps []*types.App
-	if err := json.NewDecoder(resp.Body).Decode(&apps); err != nil {
-		return 0, 0, err
+	return "unknown"
+}
+
+// importLegacyQuotasOnce imports ./quota.yml until it is found, or the
+// store holds quotas of its own, like importLegacyOnce does for contexts.
+func importLegacyQuotasOnce(store *BoltStore) error {
+	imported, err := store.LegacyQuotasImported()
+	if err != nil || imported {
+		return err
 	}
 
-	var usedCpu, usedMem float64
-	for _, app := range apps {
-		resp, _ := http.Get(fmt.Sprintf("%s/apps/%s", addr, app.ID))
-		defer resp.Body.Close()
-		var app *types.App
-		if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
-			return 0, 0, err
+	if _, err := os.Stat(legacyQuotaFile); err != nil {
+		quotas, err := store.ListQuotas()
+		if err != nil || len(quotas) == 0 {
+			return err
 		}
-		for _, task := range app.Tasks {
-			usedCpu += task.Cpu
-			usedMem += task.Mem
+		return store.MarkLegacyQuotasImported()
+	}
+
+	quotas, err := readQuotaFile(legacyQuotaFile, quotaFormatYAML)
+	if err != nil {
+		return err
+	}
+
+	var changes []*types.QuotaChange
+	for _, user := range quotas.users() {
+		for _, cluster := range sortedKeys(quotas[user]) {
+			changes = append(changes, newQuotaChange("import", user, cluster, quotas[user][cluster]))
 		}
 	}
 
-	return usedCpu, usedMem, nil
+	if err := store.ChangeQuotas(changes); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d quota(s) from %s\n", len(changes), legacyQuotaFile)
+	fmt.Fprintln(os.Stderr, "Quota files of other directories are imported with: swancfg quota import FILE")
+
+	return store.MarkLegacyQuotasImported()
 }
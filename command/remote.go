@@ -4,18 +4,18 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 )
 
 func NewRemoteCommand() cli.Command {
 	return cli.Command{
 		Name:  "remote",
-		Usage: "remote address management",
+		Usage: "remote address management of the current context",
 		Subcommands: []cli.Command{
 			cli.Command{
 				Name:  "list",
 				Usage: "list remote address(es)",
+				Flags: outputFlags(),
 				Action: func(c *cli.Context) {
 					if err := listRemotes(c); err != nil {
 						fmt.Fprintln(os.Stderr, "Error:", err)
@@ -36,33 +36,42 @@ func NewRemoteCommand() cli.Command {
 	}
 }
 
+// remote is an address of the current context.
+type remote struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
 func listRemotes(c *cli.Context) error {
-	remotes, err := getRemotes()
+	p, err := newPrinter(c)
 	if err != nil {
 		return err
 	}
 
-	printRemotes(remotes)
+	cluster, err := getCluster("")
+	if err != nil {
+		return err
+	}
 
-	return nil
-}
+	remotes := []*remote{{Name: "swan", Address: cluster.Swan}}
+	if cluster.Mesos != "" {
+		remotes = append(remotes, &remote{Name: "mesos", Address: cluster.Mesos})
+	}
 
-func printRemotes(clusters map[string]string) {
-	tb := tablewriter.NewWriter(os.Stdout)
-	tb.SetHeader([]string{
+	t := newOutputTable(
 		"REMOTE",
 		"ADDRESS",
-	})
-	for name, addr := range clusters {
-		tb.Append([]string{
-			name,
-			addr,
-		})
+	)
+	t.rowLine = true
+	for _, r := range remotes {
+		t.append(r.Name, r.Address)
 	}
-	tb.SetRowLine(true)
-	tb.Render()
+
+	return p.print(t, remotes)
 }
 
+// addRemote sets the swan or mesos address of the current context,
+// creating a default context if there is none yet.
 func addRemote(c *cli.Context) error {
 	if len(c.Args()) < 2 {
 		fmt.Println("Missing argument")
@@ -71,24 +80,42 @@ func addRemote(c *cli.Context) error {
 	}
 
 	if c.Args()[0] != "swan" && c.Args()[0] != "mesos" {
-		fmt.Println("Only swan| mesos are supported")
+		return fmt.Errorf("Only swan| mesos are supported")
 	}
 
-	db, err := NewBoltStore(".bolt.db")
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("Init store engine failed:%s", err)
+		return err
 	}
+	defer store.Close()
 
-	tx, err := db.conn.Begin(true)
+	name, err := store.CurrentCluster()
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	bucket := tx.Bucket([]byte("swan"))
-	if err := bucket.Put([]byte(c.Args()[0]), []byte(c.Args()[1])); err != nil {
+	if name == "" {
+		name = legacyCluster
+	}
+
+	cluster, err := store.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	if cluster == nil {
+		cluster = &Cluster{Name: name}
+	}
+
+	if c.Args()[0] == "swan" {
+		cluster.Swan = c.Args()[1]
+	} else {
+		cluster.Mesos = c.Args()[1]
+	}
+
+	if err := store.PutCluster(cluster); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	return store.UseCluster(name)
 }
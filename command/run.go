@@ -1,33 +1,25 @@
 package command
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
-	"gopkg.in/yaml.v2"
-)
-
-var (
-	clusterAddr string
 )
 
 func NewRunCommand() cli.Command {
 	return cli.Command{
 		Name:  "run",
 		Usage: "run new application",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "from-file, f",
-				Usage: "Run application from `FILE`",
+				Usage: "Run application from `FILE` in json, yaml or toml, - for stdin",
 			},
 			cli.StringFlag{
 				Name:  "name, n",
@@ -37,11 +29,11 @@ func NewRunCommand() cli.Command {
 				Name:  "times",
 				Usage: "Concurrent for testing",
 			},
-			cli.BoolTFlag{
+			cli.BoolFlag{
 				Name:  "disable-quota",
 				Usage: "Disable quota check",
 			},
-		},
+		}, templateFlags()...),
 		Action: func(c *cli.Context) error {
 			if err := runApplication(c); err != nil {
 				fmt.Fprintln(os.Stderr, err)
@@ -56,15 +48,9 @@ func runApplication(c *cli.Context) error {
 		return fmt.Errorf("Spec file must be specified for running application")
 	}
 
-	var spec *types.Spec
-
-	file, err := ioutil.ReadFile(c.String("from-file"))
+	spec, err := loadValidSpec(c)
 	if err != nil {
-		return fmt.Errorf("Read json file failed: %s", err.Error())
-	}
-
-	if err := json.Unmarshal(file, &spec); err != nil {
-		return fmt.Errorf("Unmarshal error: %s", err.Error())
+		return err
 	}
 
 	name := c.String("name")
@@ -72,7 +58,11 @@ func runApplication(c *cli.Context) error {
 		spec.AppName = name
 	}
 
-	if !c.BoolT("disable-quota") {
+	if err := completeSpec(spec); err != nil {
+		return err
+	}
+
+	if !c.Bool("disable-quota") {
 		if err := checkQuota(spec); err != nil {
 			return err
 		}
@@ -85,14 +75,17 @@ func runApplication(c *cli.Context) error {
 	}
 	fmt.Println("done")
 
-	fmt.Printf("===> waiting for application %s-%s-%s to running...", name, spec.RunAs, spec.Cluster)
+	appId := specAppID(spec)
+	fmt.Printf("===> waiting for application %s to running...", appId)
 	ticker := time.NewTicker(time.Duration(1 * time.Second))
-	timeout := time.NewTicker(time.Duration(10 * time.Second))
+	defer ticker.Stop()
+	timeout := time.NewTimer(time.Duration(10 * time.Second))
+	defer timeout.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			fmt.Printf(".")
-			status, err := getStatus(fmt.Sprintf("%s-%s-%s", spec.AppName, spec.RunAs, spec.Cluster))
+			status, err := getStatus(spec.Cluster, appId)
 			if err != nil {
 				return err
 			}
@@ -106,50 +99,26 @@ func runApplication(c *cli.Context) error {
 			return nil
 		}
 	}
-
-	return nil
 }
 
 func checkQuota(spec *types.Spec) error {
-	addr, err := getClusterAddr(spec.Cluster)
-	if err != nil {
-		return fmt.Errorf("Cluster can't be found. %s", err.Error())
-	}
-
-	if addr == "" {
-		return fmt.Errorf("Cluster address can't be found. %s", spec.Cluster)
-	}
+	need := specNeed(spec, int(spec.Instances))
+	need.Apps = 1
 
-	clusterAddr = addr
+	return checkQuotaFor(spec.RunAs, spec.Cluster, need)
+}
 
-	resp, err := http.Get(fmt.Sprintf("%s/apps?fields=runAs==%s", clusterAddr, spec.RunAs))
+// checkQuotaFor verifies that user has room for need on cluster, in every
+// dimension its quota limits.
+func checkQuotaFor(user, cluster string, need *quotaNeed) error {
+	fmt.Printf("===> calculating total used resources...\n")
+	used, err := getUsedQuota(user, cluster)
 	if err != nil {
-		return fmt.Errorf("Get apps failed: %s", err.Error())
-	}
-	defer resp.Body.Close()
-
-	var apps []*types.App
-	if err := json.NewDecoder(resp.Body).Decode(&apps); err != nil {
 		return err
 	}
 
-	fmt.Printf("===> calculating total used resources...\n")
-	var usedCpu, usedMem float64
-	for _, app := range apps {
-		resp, _ := http.Get(fmt.Sprintf("%s/apps/%s", clusterAddr, app.ID))
-		defer resp.Body.Close()
-		var app *types.App
-		if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
-			return err
-		}
-		for _, task := range app.Tasks {
-			usedCpu += task.Cpu
-			usedMem += task.Mem
-		}
-	}
-
 	fmt.Printf("===> calculating quota...\n")
-	quota, err := getQuota(spec.RunAs, spec.Cluster)
+	quota, err := getQuota(user, cluster)
 	if err != nil {
 		return fmt.Errorf("calculate quota got error: %s", err.Error())
 	}
@@ -158,118 +127,98 @@ func checkQuota(spec *types.Spec) error {
 		return fmt.Errorf("No quota found")
 	}
 
-	needCpu := float64(spec.Instances) * spec.Cpus
-	needMem := float64(spec.Instances) * spec.Mem
-
-	if (quota.Cpu-usedCpu) < needCpu || (quota.Memory-usedMem) < needMem {
+	if exceeded := exceededDimensions(quota, used, need); len(exceeded) > 0 {
 		fmt.Printf("===> quota exceed...\n")
-		fmt.Printf("  Total quota == Cpu: %.2f Memory: %.2f\n", quota.Cpu, quota.Memory)
-		fmt.Printf("  Use quota == Cpu: %.2f Memory: %.2f\n", usedCpu, usedMem)
-		fmt.Printf("  Left quota == Cpu: %.2f Memory: %.2f\n", quota.Cpu-usedCpu, quota.Memory-usedMem)
-		fmt.Printf("  Need quota == Cpu: %.2f Memory: %.2f\n", needCpu, needMem)
+		printQuotaReport(quota, used, need)
 
-		return fmt.Errorf("Quota exceed")
+		return fmt.Errorf("Quota exceed: %s", strings.Join(exceeded, ", "))
 	}
 
 	fmt.Printf("===> quota satisfied...\n")
 	return nil
 }
 
-func getQuota(user, cluster string) (*types.Quota, error) {
-	file, err := ioutil.ReadFile("./quota.yml")
-	if err != nil {
-		return nil, fmt.Errorf("Read quota file failed: %s", err.Error())
-	}
-
-	entries := make(map[string]map[string]*types.Quota)
-
-	yaml.Unmarshal(file, entries)
-
-	if c, ok := entries[user]; ok {
-		if quota, ok := c[cluster]; ok {
-			return quota, nil
+// exceededDimensions returns the names of the dimensions of quota that
+// need doesn't fit in.
+func exceededDimensions(quota *types.Quota, used *usage, need *quotaNeed) []string {
+	var exceeded []string
+	for _, d := range quotaDimensions {
+		if d.exceeded(quota, used, need) {
+			exceeded = append(exceeded, d.Name)
 		}
 	}
 
-	return nil, nil
+	return exceeded
 }
 
-func sendRequest(spec *types.Spec) error {
-	addr, err := getClusterAddr(spec.Cluster)
-	if err != nil {
-		return fmt.Errorf("Cluster can't be found. %s", err.Error())
-	}
-
-	if addr == "" {
-		return fmt.Errorf("Cluster address can't be found. %s", spec.Cluster)
-	}
+// printQuotaReport shows, for every dimension, the quota, what is used and
+// left, and what is needed.
+func printQuotaReport(quota *types.Quota, used *usage, need *quotaNeed) {
+	tb := tablewriter.NewWriter(os.Stdout)
+	tb.SetHeader([]string{
+		"RESOURCE",
+		"QUOTA",
+		"USED",
+		"LEFT",
+		"NEED",
+		"",
+	})
+	for _, d := range quotaDimensions {
+		usedCol, left := "-", "-"
+		if d.total {
+			usedCol = d.format(d.used(used))
+			if d.limited(quota) {
+				left = d.format(d.limit(quota) - d.used(used))
+			}
+		}
 
-	clusterAddr = addr
+		status := ""
+		if d.exceeded(quota, used, need) {
+			status = "EXCEEDED"
+		}
 
-	payload, err := json.Marshal(&spec)
-	if err != nil {
-		return fmt.Errorf("Marsh failed: %s", err.Error())
+		tb.Append([]string{
+			d.Name,
+			d.formatLimit(quota),
+			usedCol,
+			left,
+			d.format(d.need(need)),
+			status,
+		})
 	}
+	tb.Render()
+}
 
-	client := &http.Client{}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/apps", clusterAddr), bytes.NewReader(payload))
+// getQuota returns the quota of user in cluster from the store.
+func getQuota(user, cluster string) (*types.Quota, error) {
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("Make new request failed: %s", err.Error())
+		return nil, err
 	}
+	defer store.Close()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "swancfg/0.1")
-
-	resp, err := client.Do(req)
+	return store.GetQuota(user, cluster)
+}
 
+func sendRequest(spec *types.Spec) error {
+	swan, err := clusterClient(spec.Cluster)
 	if err != nil {
-		return fmt.Errorf("Send post request failed: %s", err.Error())
-	}
-
-	if resp.StatusCode != http.StatusCreated {
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-		return fmt.Errorf("%d %s", resp.StatusCode, string(data))
+		return err
 	}
 
-	return nil
+	return swan.CreateApp(context.Background(), spec)
 }
 
-func getStatus(appId string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/apps/%s", clusterAddr, appId))
+func getStatus(cluster, appId string) (string, error) {
+	swan, err := clusterClient(cluster)
 	if err != nil {
 		return "unknown", err
 	}
-	defer resp.Body.Close()
-	var app *types.App
-	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
-		return "", err
-	}
 
-	return app.State, nil
-}
-
-func getClusterAddr(name string) (string, error) {
-	f, err := os.Open("cluster.cfg")
+	app, err := swan.GetApp(context.Background(), appId)
 	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.Split(scanner.Text(), "\t\t")
-		if line[0] == name {
-			return line[1], nil
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		return "unknown", err
 	}
 
-	return "", nil
+	return app.State, nil
 }
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/urfave/cli"
+)
+
+// NewScaleCommand returns the CLI command for "scale"
+func NewScaleCommand() cli.Command {
+	return cli.Command{
+		Name:      "scale",
+		Usage:     "change the number of instances of application",
+		ArgsUsage: "[app-id] [instances]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster the application runs in [CLUSTER]",
+			},
+			cli.BoolFlag{
+				Name:  "disable-quota",
+				Usage: "Disable quota check",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: 2 * time.Minute,
+				Usage: "Time to wait for the instances to be running",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := scaleApplication(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// scaleApplication executes the "scale" command.
+func scaleApplication(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return fmt.Errorf("App ID and instances required")
+	}
+
+	appId := c.Args()[0]
+	target, err := strconv.Atoi(c.Args()[1])
+	if err != nil || target < 0 {
+		return fmt.Errorf("invalid instances %q", c.Args()[1])
+	}
+
+	swan, err := appClient(appId, c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	app, err := swan.GetApp(ctx, appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return fmt.Errorf("app %s not found", appId)
+		}
+		return err
+	}
+
+	if target == app.Instances {
+		fmt.Printf("===> application %s already has %d instances\n", appId, target)
+		return nil
+	}
+
+	// Only the added instances consume more quota.
+	delta := target - app.Instances
+	if delta > 0 && !c.Bool("disable-quota") {
+		spec := app.CurrentVersion
+		if spec == nil {
+			return fmt.Errorf("current version of %s unknown, can't check quota", appId)
+		}
+
+		cluster := spec.Cluster
+		if cluster == "" {
+			cluster = appCluster(appId)
+		}
+
+		if err := checkQuotaFor(app.RunAs, cluster, specNeed(spec, delta)); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("===> scaling %s from %d to %d instances...", appId, app.Instances, target)
+	if err := swan.ScaleApp(ctx, appId, target); err != nil {
+		fmt.Println("failed")
+		return err
+	}
+	fmt.Println("done")
+
+	if err := waitForInstances(swan, appId, target, c.Duration("wait")); err != nil {
+		return err
+	}
+
+	fmt.Printf("===> application %s scaled to %d instances\n", appId, target)
+	return nil
+}
+
+// waitForInstances waits until target instances of the app are running,
+// redrawing the progress on a single line.
+func waitForInstances(swan *client.Client, appId string, target int, timeout time.Duration) error {
+	var running int
+	ok, err := waitFor(timeout, func() (bool, error) {
+		app, err := swan.GetApp(context.Background(), appId)
+		if err != nil {
+			return false, err
+		}
+
+		running = app.RunningInstances
+		fmt.Printf("\r===> waiting for %s: %d/%d instances running", appId, running, target)
+
+		return running == target, nil
+	})
+	fmt.Println()
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("timeout after %s with %d/%d instances running", timeout, running, target)
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// Operators of selector requirements.
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+	selectorExists    = "exists"
+	selectorNotExists = "!"
+)
+
+// appFields are the fields of an app field selectors match on.
+var appFields = map[string]func(*types.App) string{
+	"id":      func(app *types.App) string { return app.ID },
+	"name":    func(app *types.App) string { return app.Name },
+	"runAs":   func(app *types.App) string { return app.RunAs },
+	"cluster": func(app *types.App) string { return appCluster(app.ID) },
+	"state":   func(app *types.App) string { return app.State },
+	"image": func(app *types.App) string {
+		if app.CurrentVersion == nil {
+			return ""
+		}
+		return specImage(app.CurrentVersion)
+	},
+}
+
+// pushedFields are the app fields swan filters on itself, by the name of
+// its fields parameter.
+var pushedFields = map[string]string{
+	"runAs": "runAs",
+}
+
+var (
+	selectorSet  = regexp.MustCompile(`^(\S+)\s+(in|notin)\s+\((.*)\)$`)
+	selectorName = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?$`)
+)
+
+// requirement is one comma separated term of a selector.
+type requirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+func (r *requirement) matches(value string, exists bool) bool {
+	switch r.op {
+	case selectorExists:
+		return exists
+	case selectorNotExists:
+		return !exists
+	case selectorEquals, selectorIn:
+		return exists && oneOf(value, r.values, false)
+	default:
+		return !exists || !oneOf(value, r.values, false)
+	}
+}
+
+// appFilter selects apps by label and field selectors. The zero value
+// selects every app.
+type appFilter struct {
+	labels []*requirement
+	fields []*requirement
+}
+
+// selectorFlags returns the flags of commands working on the apps
+// matching selectors.
+func selectorFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "selector, l",
+			Usage: "Select apps by labels, e.g. team=payments,env!=prod,tier in (web,api),!canary",
+		},
+		cli.StringFlag{
+			Name:  "field-selector",
+			Usage: "Select apps by id, name, runAs, cluster, state or image, e.g. state=normal,runAs!=root",
+		},
+	}
+}
+
+// newAppFilter parses the selector flags.
+func newAppFilter(c *cli.Context) (*appFilter, error) {
+	labels, err := parseSelector(c.String("selector"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %s", err.Error())
+	}
+
+	fields, err := parseSelector(c.String("field-selector"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector: %s", err.Error())
+	}
+
+	for _, r := range fields {
+		if _, ok := appFields[r.key]; !ok {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", r.key, strings.Join(appFieldNames(), ", "))
+		}
+	}
+
+	return &appFilter{labels: labels, fields: fields}, nil
+}
+
+// userFilter selects the apps of user, or every app when user is empty.
+func userFilter(user string) *appFilter {
+	return (&appFilter{}).withField("runAs", user)
+}
+
+// withField adds the requirement that field equals value, unless value
+// is empty. It returns f.
+func (f *appFilter) withField(field, value string) *appFilter {
+	if value != "" {
+		f.fields = append(f.fields, &requirement{key: field, op: selectorEquals, values: []string{value}})
+	}
+
+	return f
+}
+
+// parseSelector parses a selector like a=b,c!=d,e in (f,g),h,!i.
+func parseSelector(s string) ([]*requirement, error) {
+	var reqs []*requirement
+	for _, term := range splitSelector(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, r)
+	}
+
+	return reqs, nil
+}
+
+// splitSelector splits s at the commas outside of parentheses.
+func splitSelector(s string) []string {
+	var (
+		terms []string
+		depth int
+		start int
+	)
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (*requirement, error) {
+	r := &requirement{}
+
+	switch {
+	case selectorSet.MatchString(term):
+		m := selectorSet.FindStringSubmatch(term)
+		r.key, r.op = m[1], m[2]
+		for _, v := range strings.Split(m[3], ",") {
+			r.values = append(r.values, strings.TrimSpace(v))
+		}
+	case strings.Contains(term, "!="):
+		parts := strings.SplitN(term, "!=", 2)
+		r.key, r.op, r.values = parts[0], selectorNotEquals, []string{parts[1]}
+	case strings.Contains(term, "=="):
+		parts := strings.SplitN(term, "==", 2)
+		r.key, r.op, r.values = parts[0], selectorEquals, []string{parts[1]}
+	case strings.Contains(term, "="):
+		parts := strings.SplitN(term, "=", 2)
+		r.key, r.op, r.values = parts[0], selectorEquals, []string{parts[1]}
+	case strings.HasPrefix(term, "!"):
+		r.key, r.op = term[1:], selectorNotExists
+	default:
+		r.key, r.op = term, selectorExists
+	}
+
+	r.key = strings.TrimSpace(r.key)
+	if !selectorName.MatchString(r.key) {
+		return nil, fmt.Errorf("invalid key %q in %q", r.key, term)
+	}
+	for i, v := range r.values {
+		r.values[i] = strings.TrimSpace(v)
+	}
+
+	return r, nil
+}
+
+// empty reports whether f selects every app.
+func (f *appFilter) empty() bool {
+	return len(f.labels) == 0 && len(f.fields) == 0
+}
+
+// needsSpec reports whether matching needs the current version of apps,
+// which swan may leave out of listings.
+func (f *appFilter) needsSpec() bool {
+	if len(f.labels) > 0 {
+		return true
+	}
+
+	for _, r := range f.fields {
+		if r.key == "image" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// options pushes the requirements swan can evaluate down to its fields
+// filter. Apps are still matched with matches afterwards.
+func (f *appFilter) options() *client.ListOptions {
+	opts := &client.ListOptions{}
+	for _, r := range f.fields {
+		name, ok := pushedFields[r.key]
+		if !ok {
+			continue
+		}
+
+		if r.op == selectorEquals {
+			opts.Fields = append(opts.Fields, fmt.Sprintf("%s==%s", name, r.values[0]))
+		}
+	}
+
+	return opts
+}
+
+// matches reports whether app meets every requirement of f.
+func (f *appFilter) matches(app *types.App) bool {
+	var labels map[string]string
+	if app.CurrentVersion != nil {
+		labels = app.CurrentVersion.Labels
+	}
+
+	for _, r := range f.labels {
+		value, ok := labels[r.key]
+		if !r.matches(value, ok) {
+			return false
+		}
+	}
+
+	for _, r := range f.fields {
+		value := appFields[r.key](app)
+		if !r.matches(value, value != "") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesField reports whether value meets the requirements of f on
+// field, ignoring the others.
+func (f *appFilter) matchesField(field, value string) bool {
+	for _, r := range f.fields {
+		if r.key == field && !r.matches(value, value != "") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// selectApps lists the apps of swan f selects. Apps are got one by one
+// when swan lists them without the version f needs to match.
+func selectApps(ctx context.Context, swan *client.Client, f *appFilter) ([]*types.App, error) {
+	apps, err := swan.ListApps(ctx, f.options())
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*types.App
+	for _, app := range apps {
+		if f.needsSpec() && app.CurrentVersion == nil {
+			detail, err := swan.GetApp(ctx, app.ID)
+			if err != nil {
+				if client.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			app = detail
+		}
+
+		if f.matches(app) {
+			selected = append(selected, app)
+		}
+	}
+
+	return selected, nil
+}
+
+func appFieldNames() []string {
+	var names []string
+	for name := range appFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,130 @@
+package command
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     []*requirement
+		err      bool
+	}{
+		{selector: "", want: nil},
+		{selector: " , ", want: nil},
+		{
+			selector: "team=payments",
+			want:     []*requirement{{key: "team", op: selectorEquals, values: []string{"payments"}}},
+		},
+		{
+			selector: "team==payments",
+			want:     []*requirement{{key: "team", op: selectorEquals, values: []string{"payments"}}},
+		},
+		{
+			selector: "env!=prod",
+			want:     []*requirement{{key: "env", op: selectorNotEquals, values: []string{"prod"}}},
+		},
+		{
+			selector: "team=",
+			want:     []*requirement{{key: "team", op: selectorEquals, values: []string{""}}},
+		},
+		{
+			selector: "tier in (web, api)",
+			want:     []*requirement{{key: "tier", op: selectorIn, values: []string{"web", "api"}}},
+		},
+		{
+			selector: "tier notin (web)",
+			want:     []*requirement{{key: "tier", op: selectorNotIn, values: []string{"web"}}},
+		},
+		{
+			selector: "canary",
+			want:     []*requirement{{key: "canary", op: selectorExists}},
+		},
+		{
+			selector: "!canary",
+			want:     []*requirement{{key: "canary", op: selectorNotExists}},
+		},
+		{
+			selector: " team = payments , tier in (web,api),!canary",
+			want: []*requirement{
+				{key: "team", op: selectorEquals, values: []string{"payments"}},
+				{key: "tier", op: selectorIn, values: []string{"web", "api"}},
+				{key: "canary", op: selectorNotExists},
+			},
+		},
+		{
+			selector: "example.com/team=payments",
+			want:     []*requirement{{key: "example.com/team", op: selectorEquals, values: []string{"payments"}}},
+		},
+		{selector: "=payments", err: true},
+		{selector: "!", err: true},
+		{selector: "team name=payments", err: true},
+		{selector: "-team=payments", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseSelector(test.selector)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseSelector(%q) = %v, want an error", test.selector, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseSelector(%q) failed: %s", test.selector, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSelector(%q) = %s, want %s", test.selector, requirementsString(got), requirementsString(test.want))
+		}
+	}
+}
+
+func TestRequirementMatches(t *testing.T) {
+	tests := []struct {
+		selector string
+		value    string
+		exists   bool
+		want     bool
+	}{
+		{"team=payments", "payments", true, true},
+		{"team=payments", "search", true, false},
+		{"team=payments", "", false, false},
+		{"team!=payments", "payments", true, false},
+		{"team!=payments", "search", true, true},
+		{"team!=payments", "", false, true},
+		{"team in (payments,search)", "search", true, true},
+		{"team in (payments,search)", "ads", true, false},
+		{"team notin (payments,search)", "ads", true, true},
+		{"team notin (payments,search)", "", false, true},
+		{"team", "", true, true},
+		{"team", "", false, false},
+		{"!team", "payments", true, false},
+		{"!team", "", false, true},
+	}
+
+	for _, test := range tests {
+		reqs, err := parseSelector(test.selector)
+		if err != nil || len(reqs) != 1 {
+			t.Fatalf("parseSelector(%q) = %v, %v", test.selector, reqs, err)
+		}
+
+		if got := reqs[0].matches(test.value, test.exists); got != test.want {
+			t.Errorf("%q matches %q (exists %t) = %t, want %t", test.selector, test.value, test.exists, got, test.want)
+		}
+	}
+}
+
+func requirementsString(reqs []*requirement) string {
+	var terms []string
+	for _, r := range reqs {
+		terms = append(terms, fmt.Sprintf("%s %s %q", r.key, r.op, r.values))
+	}
+
+	return "[" + strings.Join(terms, ", ") + "]"
+}
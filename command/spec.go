@@ -0,0 +1,295 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"gopkg.in/yaml.v2"
+)
+
+// specFile is an application spec read from disk, kept as a generic
+// document so that it can be validated before being decoded. Numbers in
+// the document are json.Number whatever the format of the file.
+type specFile struct {
+	Path string
+	Doc  interface{}
+}
+
+// Spec file formats.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+)
+
+// tomlTable matches the table headers TOML files start with, which no
+// JSON or YAML spec contains.
+var tomlTable = regexp.MustCompile(`(?m)^\s*\[\[?[A-Za-z0-9_.]+\]\]?\s*(#.*)?$`)
+
+// readSpec reads the spec file at path and substitutes vars in it,
+// without decoding it into a Spec. The spec is read from stdin when path
+// is "-".
+func readSpec(path string, vars map[string]string) (*specFile, error) {
+	var (
+		file []byte
+		err  error
+	)
+	if path == "-" {
+		file, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		file, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Read spec file failed: %s", err.Error())
+	}
+
+	f := &specFile{Path: path}
+
+	if file, err = renderSpec(file, vars); err != nil {
+		return nil, fmt.Errorf("Render %s error: %s", f.Name(), err.Error())
+	}
+
+	if err := f.decode(file); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// decode decodes file, in the format told by the path of f or its
+// content.
+func (f *specFile) decode(file []byte) error {
+	var err error
+	switch specFormat(f.Path, file) {
+	case formatYAML:
+		err = f.decodeYAML(file)
+	case formatTOML:
+		err = f.decodeTOML(file)
+	default:
+		err = f.decodeJSON(file)
+	}
+	if err != nil {
+		return fmt.Errorf("Unmarshal %s error: %s", f.Name(), err.Error())
+	}
+
+	if f.Doc == nil {
+		return fmt.Errorf("Spec file %s is empty", f.Name())
+	}
+
+	return nil
+}
+
+// Name returns the name of the file in messages.
+func (f *specFile) Name() string {
+	if f.Path == "-" {
+		return "stdin"
+	}
+
+	return f.Path
+}
+
+// specFormat tells the format of a spec file by its extension, or by its
+// content when the extension says nothing.
+func specFormat(path string, file []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".yml", ".yaml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	}
+
+	content := bytes.TrimSpace(file)
+	switch {
+	case len(content) == 0 || content[0] == '{':
+		return formatJSON
+	case tomlTable.Match(content):
+		return formatTOML
+	}
+
+	return formatYAML
+}
+
+func (f *specFile) decodeJSON(file []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.UseNumber()
+	if err := decoder.Decode(&f.Doc); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return jsonError(file, err)
+	}
+
+	return nil
+}
+
+func (f *specFile) decodeYAML(file []byte) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(file, &doc); err != nil {
+		return err
+	}
+
+	f.Doc = normalizeDoc(doc)
+
+	return nil
+}
+
+func (f *specFile) decodeTOML(file []byte) error {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(file), &doc); err != nil {
+		return err
+	}
+
+	if len(doc) > 0 {
+		f.Doc = normalizeDoc(doc)
+	}
+
+	return nil
+}
+
+// jsonError adds the line and column of the error position to the
+// errors of encoding/json, which only give a byte offset.
+func jsonError(file []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		if err == io.ErrUnexpectedEOF {
+			offset = int64(len(file))
+		} else {
+			return err
+		}
+	}
+
+	if offset > int64(len(file)) {
+		offset = int64(len(file))
+	}
+
+	before := file[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return fmt.Errorf("line %d, column %d: %s", line, column, err.Error())
+}
+
+// normalizeDoc turns a document decoded from YAML or TOML into the shape
+// encoding/json decodes to: maps keyed by strings and json.Number numbers.
+func normalizeDoc(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeDoc(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = normalizeDoc(item)
+		}
+		return m
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeDoc(item)
+		}
+		return list
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeDoc(item)
+		}
+		return list
+	case int:
+		return json.Number(strconv.FormatInt(int64(v), 10))
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+
+	return val
+}
+
+// Spec decodes the document into a Spec.
+func (f *specFile) Spec() (*types.Spec, error) {
+	data, err := json.Marshal(f.Doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec *types.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("Unmarshal error: %s", err.Error())
+	}
+
+	return spec, nil
+}
+
+// liveSpec returns the spec an app currently runs. Scaling changes the
+// instances of the app but not of its version, so they are taken from the
+// app.
+func liveSpec(app *types.App) *types.Spec {
+	spec := &types.Spec{}
+	if app.CurrentVersion != nil {
+		*spec = *app.CurrentVersion
+	}
+	spec.Instances = int32(app.Instances)
+
+	return spec
+}
+
+// completeSpec fills in the cluster and user of spec from the current
+// context when the file leaves them out.
+func completeSpec(spec *types.Spec) error {
+	if spec.Cluster != "" && spec.RunAs != "" {
+		return nil
+	}
+
+	cluster, err := getCluster(spec.Cluster)
+	if err != nil {
+		return err
+	}
+
+	if spec.Cluster == "" {
+		spec.Cluster = cluster.Name
+	}
+	if spec.RunAs == "" {
+		spec.RunAs = cluster.User
+	}
+
+	return nil
+}
+
+// specAppID returns the id swan gives to the app created from spec.
+func specAppID(spec *types.Spec) string {
+	return fmt.Sprintf("%s-%s-%s", spec.AppName, spec.RunAs, spec.Cluster)
+}
+
+// specImage returns the docker image of spec, if any.
+func specImage(spec *types.Spec) string {
+	if spec.Container == nil || spec.Container.Docker == nil {
+		return ""
+	}
+
+	return spec.Container.Docker.Image
+}
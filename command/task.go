@@ -0,0 +1,284 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// NewTaskCommand returns the CLI command for "task"
+func NewTaskCommand() cli.Command {
+	taskFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "app",
+			Usage: "App of the task, when its ID doesn't start with the instance index [APP-ID]",
+		},
+		cli.StringFlag{
+			Name:  "cluster",
+			Usage: "Cluster the application runs in [CLUSTER]",
+		},
+	}
+
+	waitFlag := cli.DurationFlag{
+		Name:  "wait",
+		Value: 2 * time.Minute,
+		Usage: "Time to wait for the new task to be running and healthy",
+	}
+
+	return cli.Command{
+		Name:  "task",
+		Usage: "operate on a single task of an application",
+		Subcommands: []cli.Command{
+			{
+				Name:      "kill",
+				Usage:     "kill a task and wait for swan to replace it",
+				ArgsUsage: "[task-id]",
+				Flags:     append(taskFlags, waitFlag),
+				Action: func(c *cli.Context) error {
+					if err := replaceTask(c, "killing", (*client.Client).KillTask); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+						return cli.NewExitError("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "restart",
+				Usage:     "restart a task and wait for the new one",
+				ArgsUsage: "[task-id]",
+				Flags:     append(taskFlags, waitFlag),
+				Action: func(c *cli.Context) error {
+					if err := replaceTask(c, "restarting", (*client.Client).RestartTask); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+						return cli.NewExitError("", 1)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "describe",
+				Usage:     "show everything swan knows of a task",
+				ArgsUsage: "[task-id]",
+				Flags:     append(taskFlags, outputFlags()...),
+				Action: func(c *cli.Context) error {
+					if err := describeTask(c); err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
+						return cli.NewExitError("", 1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// taskAppID returns the app of a task from its ID, which is the instance
+// index followed by the app ID, or "" when it isn't of that form.
+func taskAppID(taskId string) string {
+	parts := strings.SplitN(taskId, "-", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	if _, err := strconv.Atoi(parts[0]); err != nil {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// findTask gets the app of the task named by the first argument, and the
+// task.
+func findTask(c *cli.Context) (*client.Client, *types.App, *types.Task, error) {
+	if len(c.Args()) == 0 {
+		return nil, nil, nil, fmt.Errorf("Task ID required")
+	}
+	taskId := c.Args()[0]
+
+	appId := c.String("app")
+	if appId == "" {
+		appId = taskAppID(taskId)
+	}
+	if appId == "" {
+		return nil, nil, nil, fmt.Errorf("app of task %s unknown, set it with --app", taskId)
+	}
+
+	swan, err := appClient(appId, c.String("cluster"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	app, err := swan.GetApp(context.Background(), appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return nil, nil, nil, fmt.Errorf("app %s not found", appId)
+		}
+		return nil, nil, nil, err
+	}
+
+	for _, task := range app.Tasks {
+		if task.ID == taskId {
+			return swan, app, task, nil
+		}
+	}
+
+	return nil, nil, nil, fmt.Errorf("task %s not found in app %s", taskId, appId)
+}
+
+// replaceTask executes the "task kill" and "task restart" commands, which
+// differ in the request sent.
+func replaceTask(c *cli.Context, verb string, send func(*client.Client, context.Context, string, string) error) error {
+	swan, app, task, err := findTask(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("===> %s task %s...", verb, task.ID)
+	if err := send(swan, context.Background(), app.ID, task.ID); err != nil {
+		fmt.Println("failed")
+		return err
+	}
+	fmt.Println("done")
+
+	checked := app.CurrentVersion != nil && len(app.CurrentVersion.HealthChecks) > 0
+	replacement, err := waitForReplacement(swan, app, task, checked, c.Duration("wait"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("===> task %s replaced by a running task on %s\n", task.ID, replacement.AgentHostname)
+	return nil
+}
+
+// waitForReplacement waits until a new run of task is running and, when
+// checked, healthy. Swan either starts a new run in the slot of the task,
+// moving the old one to its history, or adds a task with a new ID.
+func waitForReplacement(swan *client.Client, app *types.App, old *types.Task, checked bool, timeout time.Duration) (*types.Task, error) {
+	known := make(map[string]bool)
+	for _, task := range app.Tasks {
+		known[task.ID] = true
+	}
+
+	var (
+		replacement *types.Task
+		status      = "pending"
+	)
+	ok, err := waitFor(timeout, func() (bool, error) {
+		cur, err := swan.GetApp(context.Background(), app.ID)
+		if err != nil {
+			return false, err
+		}
+
+		for _, task := range cur.Tasks {
+			rerun := task.ID == old.ID && (len(task.History) > len(old.History) || !task.Created.Equal(old.Created))
+			if !rerun && known[task.ID] {
+				continue
+			}
+
+			replacement = task
+			status = stateMap[task.Status]
+			if status == "" {
+				status = task.Status
+			}
+			if checked && task.Status == "slot_task_running" && !task.Healthy {
+				status = "unhealthy"
+			}
+			if taskReady(task, checked) {
+				break
+			}
+		}
+		fmt.Printf("\r===> waiting for the replacement of %s: %-12s", old.ID, status)
+
+		return replacement != nil && taskReady(replacement, checked), nil
+	})
+	fmt.Println()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("timeout after %s with the replacement of %s %s", timeout, old.ID, status)
+	}
+
+	return replacement, nil
+}
+
+// describeTask executes the "task describe" command.
+func describeTask(c *cli.Context) error {
+	p, err := newPrinter(c)
+	if err != nil {
+		return err
+	}
+
+	_, _, task, err := findTask(c)
+	if err != nil {
+		return err
+	}
+
+	if p.format != formatTable && p.format != formatWide {
+		return p.print(nil, task)
+	}
+
+	status := stateMap[task.Status]
+	if status == "" {
+		status = task.Status
+	}
+
+	created := ""
+	if !task.Created.IsZero() {
+		created = task.Created.Local().Format("2006-01-02 15:04:05")
+	}
+
+	fmt.Printf("ID:        %s\n", task.ID)
+	fmt.Printf("App:       %s\n", task.AppId)
+	fmt.Printf("Version:   %s\n", task.VersionId)
+	fmt.Printf("Status:    %s\n", status)
+	fmt.Printf("Healthy:   %s\n", healthyMap[task.Healthy])
+	fmt.Printf("Image:     %s\n", task.Image)
+	fmt.Printf("Resources: cpus %.2f, mem %.f, disk %.f\n", task.Cpu, task.Mem, task.Disk)
+	fmt.Printf("IP:        %s\n", task.IP)
+	fmt.Printf("Agent:     %s (%s)\n", task.AgentHostname, task.AgentId)
+	fmt.Printf("Offer:     %s\n", task.OfferId)
+	fmt.Printf("Created:   %s\n", created)
+
+	if len(task.History) == 0 {
+		fmt.Println("History:   none")
+		return nil
+	}
+
+	fmt.Println("History:")
+	t := newOutputTable(
+		"RUN",
+		"AGENT",
+		"OFFER",
+		"VERSIONID",
+		"STATE",
+		"REASON",
+	)
+	for _, h := range task.History {
+		agent := h.AgentHostname
+		if agent == "" {
+			agent = h.AgentId
+		}
+
+		t.append(
+			h.ID,
+			agent,
+			h.OfferId,
+			h.VersionId,
+			h.State,
+			h.Reason,
+		)
+	}
+	t.render(os.Stdout, false, !p.noHeaders)
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// specVariable matches ${NAME} and ${NAME:-default} in spec files. $$ is
+// matched too, so that $${NAME} can escape a literal ${NAME}.
+var specVariable = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_.-]*)(:-([^}]*))?\}`)
+
+// templateFlags returns the flags setting the variables of spec files.
+func templateFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "set",
+			Usage: "Set spec variable `KEY=VALUE`, may be repeated",
+		},
+		cli.StringFlag{
+			Name:  "values",
+			Usage: "Read spec variables from yaml `FILE`",
+		},
+	}
+}
+
+// specVars returns the variables substituted in spec files: the process
+// environment, overridden by the --values file, overridden by --set.
+func specVars(c *cli.Context) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, env := range os.Environ() {
+		if i := strings.Index(env, "="); i > 0 {
+			vars[env[:i]] = env[i+1:]
+		}
+	}
+
+	if path := c.String("values"); path != "" {
+		file, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Read values file failed: %s", err.Error())
+		}
+
+		var doc interface{}
+		if err := yaml.Unmarshal(file, &doc); err != nil {
+			return nil, fmt.Errorf("Unmarshal %s error: %s", path, err.Error())
+		}
+
+		if doc != nil {
+			m, ok := normalizeDoc(doc).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Values file %s must be a mapping", path)
+			}
+			flattenVars(vars, "", m)
+		}
+	}
+
+	for _, set := range c.StringSlice("set") {
+		i := strings.Index(set, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid --set %q, expected KEY=VALUE", set)
+		}
+		vars[set[:i]] = set[i+1:]
+	}
+
+	return vars, nil
+}
+
+// flattenVars adds the values of a nested mapping to vars, joining the
+// keys with dots: {image: {tag: v1}} sets image.tag.
+func flattenVars(vars map[string]string, prefix string, val interface{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			flattenVars(vars, prefix+key+".", item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenVars(vars, fmt.Sprintf("%s%d.", prefix, i), item)
+		}
+	case nil:
+		vars[strings.TrimSuffix(prefix, ".")] = ""
+	default:
+		vars[strings.TrimSuffix(prefix, ".")] = fmt.Sprint(v)
+	}
+}
+
+// renderSpec substitutes the variables of a spec file. Every variable
+// without a value or default is reported with its line; text meant for
+// swan or the container, like ${PORT0}, is written $${PORT0}.
+func renderSpec(file []byte, vars map[string]string) ([]byte, error) {
+	var (
+		out     bytes.Buffer
+		missing []string
+		last    int
+	)
+
+	for _, m := range specVariable.FindAllSubmatchIndex(file, -1) {
+		out.Write(file[last:m[0]])
+		last = m[1]
+
+		if m[2] < 0 {
+			// $$ is an escaped $.
+			out.WriteByte('$')
+			continue
+		}
+
+		name := string(file[m[2]:m[3]])
+		if val, ok := vars[name]; ok {
+			out.WriteString(val)
+			continue
+		}
+
+		if m[4] >= 0 {
+			out.Write(file[m[6]:m[7]])
+			continue
+		}
+
+		line := bytes.Count(file[:m[0]], []byte("\n")) + 1
+		missing = append(missing, fmt.Sprintf("line %d: ${%s}", line, name))
+	}
+	out.Write(file[last:])
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Spec variables not set, use --set, --values or the environment:\n  %s", strings.Join(missing, "\n  "))
+	}
+
+	return out.Bytes(), nil
+}
+
+// NewRenderCommand returns the CLI command for "render"
+func NewRenderCommand() cli.Command {
+	return cli.Command{
+		Name:  "render",
+		Usage: "print application spec with its variables substituted",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "from-file, f",
+				Usage: "Render application spec in `FILE`, - for stdin",
+			},
+		}, templateFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := renderSpecFile(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// renderSpecFile executes the "render" command.
+func renderSpecFile(c *cli.Context) error {
+	if c.String("from-file") == "" {
+		return fmt.Errorf("Spec file must be specified for rendering application")
+	}
+
+	vars, err := specVars(c)
+	if err != nil {
+		return err
+	}
+
+	f, err := readSpec(c.String("from-file"), vars)
+	if err != nil {
+		return err
+	}
+
+	problems := validateSpec(f)
+	printProblems(os.Stderr, problems)
+	if hasErrors(problems) {
+		return fmt.Errorf("Spec %s is invalid", f.Name())
+	}
+
+	spec, err := f.Spec()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(data))
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestSpecVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swancfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	values := filepath.Join(dir, "values.yml")
+	err = ioutil.WriteFile(values, []byte("TAG: values\nREPLICAS: 3\nimage:\n  name: nginx\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, val := range map[string]string{"SWANCFG_TAG": "env", "SWANCFG_ENV": "env"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, val)
+	}
+
+	tests := []struct {
+		args []string
+		name string
+		want string
+	}{
+		{nil, "SWANCFG_ENV", "env"},
+		{[]string{"--values", values}, "SWANCFG_ENV", "env"},
+		{[]string{"--values", values}, "TAG", "values"},
+		{[]string{"--values", values}, "REPLICAS", "3"},
+		{[]string{"--values", values}, "image.name", "nginx"},
+		{[]string{"--set", "SWANCFG_TAG=set"}, "SWANCFG_TAG", "set"},
+		{[]string{"--values", values, "--set", "TAG=set"}, "TAG", "set"},
+		{[]string{"--set", "TAG=a=b"}, "TAG", "a=b"},
+		{[]string{"--set", "TAG="}, "TAG", ""},
+	}
+
+	for _, test := range tests {
+		vars, err := specVars(templateContext(t, test.args))
+		if err != nil {
+			t.Errorf("specVars(%q) failed: %s", test.args, err)
+			continue
+		}
+
+		if got, ok := vars[test.name]; !ok || got != test.want {
+			t.Errorf("specVars(%q)[%s] = %q, want %q", test.args, test.name, got, test.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--set", "TAG"},
+		{"--set", "=v1"},
+		{"--values", filepath.Join(dir, "missing.yml")},
+	} {
+		if _, err := specVars(templateContext(t, args)); err == nil {
+			t.Errorf("specVars(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestRenderSpec(t *testing.T) {
+	vars := map[string]string{"TAG": "v1", "EMPTY": "", "image.name": "nginx"}
+
+	tests := []struct {
+		file    string
+		want    string
+		missing []string
+	}{
+		{file: `image: ${image.name}:${TAG}`, want: `image: nginx:v1`},
+		{file: `tag: "${EMPTY}"`, want: `tag: ""`},
+		{file: `tag: ${TAG:-latest}`, want: `tag: v1`},
+		{file: `cpus: ${CPUS:-0.5}`, want: `cpus: 0.5`},
+		{file: `tag: "${CPUS:-}"`, want: `tag: ""`},
+		{file: `port: $${PORT0}`, want: `port: ${PORT0}`},
+		{file: `cost: $$5, $${TAG}-${TAG}`, want: `cost: $5, ${TAG}-v1`},
+		{file: `cost: $5 $TAG`, want: `cost: $5 $TAG`},
+		{
+			file:    "image: nginx:${TAG}\nname: ${NAME}\ncpus: ${CPUS}",
+			missing: []string{"line 2: ${NAME}", "line 3: ${CPUS}"},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := renderSpec([]byte(test.file), vars)
+		if test.missing != nil {
+			if err == nil {
+				t.Errorf("renderSpec(%q) = %q, want an error", test.file, got)
+				continue
+			}
+			for _, missing := range test.missing {
+				if !strings.Contains(err.Error(), missing) {
+					t.Errorf("renderSpec(%q) error %q does not report %s", test.file, err, missing)
+				}
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("renderSpec(%q) failed: %s", test.file, err)
+			continue
+		}
+
+		if string(got) != test.want {
+			t.Errorf("renderSpec(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+// templateContext returns the context of a command with the template
+// flags, parsed from args.
+func templateContext(t *testing.T, args []string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range templateFlags() {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return cli.NewContext(nil, set, nil)
+}
@@ -0,0 +1,330 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// NewTopCommand returns the CLI command for "top"
+func NewTopCommand() cli.Command {
+	return cli.Command{
+		Name:  "top",
+		Usage: "show the resources used by applications, refreshing",
+		Description: "Redraws in place on a terminal, otherwise prints a line per application\n" +
+			"   and refresh. Numeric columns sort largest first.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Show apps of cluster [CLUSTER]",
+			},
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "Show apps of user [USER]",
+			},
+			cli.StringFlag{
+				Name:  "sort, s",
+				Value: "cpu",
+				Usage: "Sort by " + strings.Join(topColumnNames(), ", "),
+			},
+			cli.BoolFlag{
+				Name:  "reverse, r",
+				Usage: "Reverse the sort order",
+			},
+			cli.DurationFlag{
+				Name:  "interval, d",
+				Value: 3 * time.Second,
+				Usage: "Time between refreshes",
+			},
+			cli.IntFlag{
+				Name:  "iterations, n",
+				Usage: "Stop after this many refreshes, 0 for never",
+			},
+		}, selectorFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := runTop(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			return nil
+		},
+	}
+}
+
+// topRow is what one app uses, and what its user has left.
+type topRow struct {
+	App       string
+	User      string
+	Instances int
+	Running   int
+	Healthy   int
+	Checked   bool
+	Cpu       float64
+	Mem       float64
+	Disk      float64
+
+	// CpuLeft and MemLeft are nil when the user has no quota.
+	CpuLeft *float64
+	MemLeft *float64
+}
+
+// topColumn is a column of top, which it can be sorted by.
+type topColumn struct {
+	Name    string
+	numeric bool
+	value   func(*topRow) float64
+	text    func(*topRow) string
+}
+
+var topColumns = []*topColumn{
+	{Name: "app", text: func(r *topRow) string { return r.App }},
+	{Name: "user", text: func(r *topRow) string { return r.User }},
+	{Name: "instances", numeric: true, value: func(r *topRow) float64 { return float64(r.Instances) }},
+	{Name: "running", numeric: true, value: func(r *topRow) float64 { return float64(r.Running) }},
+	{Name: "healthy", numeric: true, value: func(r *topRow) float64 { return float64(r.Healthy) }},
+	{Name: "cpu", numeric: true, value: func(r *topRow) float64 { return r.Cpu }},
+	{Name: "mem", numeric: true, value: func(r *topRow) float64 { return r.Mem }},
+	{Name: "disk", numeric: true, value: func(r *topRow) float64 { return r.Disk }},
+	{Name: "cpu-left", numeric: true, value: func(r *topRow) float64 { return leftValue(r.CpuLeft) }},
+	{Name: "mem-left", numeric: true, value: func(r *topRow) float64 { return leftValue(r.MemLeft) }},
+}
+
+// runTop executes the "top" command.
+func runTop(c *cli.Context) error {
+	column := findTopColumn(c.String("sort"))
+	if column == nil {
+		return fmt.Errorf("unknown sort column %q, expected one of %s", c.String("sort"), strings.Join(topColumnNames(), ", "))
+	}
+
+	if c.Duration("interval") <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	filter, err := newAppFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.withField("runAs", c.String("user"))
+
+	cluster, err := getCluster(c.String("cluster"))
+	if err != nil {
+		return err
+	}
+
+	if cluster.Swan == "" {
+		return fmt.Errorf("swan address of context %s not set", cluster.Name)
+	}
+	swan := newClient(cluster)
+
+	tty := isTerminal(os.Stdout)
+	for i := 1; ; i++ {
+		// Quota headroom counts every app of a user, not only the shown
+		// ones.
+		apps, err := fetchApps(swan, userFilter(c.String("user")))
+		if err != nil {
+			return err
+		}
+
+		quotas, err := getQuotas()
+		if err != nil {
+			return err
+		}
+
+		rows := topRows(apps, filter, quotas, cluster.Name)
+		sortTopRows(rows, column, c.Bool("reverse"))
+
+		now := time.Now()
+		if tty {
+			var buf bytes.Buffer
+			printTopTable(&buf, rows, cluster.Name, now)
+			fmt.Print(clearScreen + buf.String())
+		} else {
+			printTopLines(os.Stdout, rows, now)
+		}
+
+		if n := c.Int("iterations"); n > 0 && i >= n {
+			return nil
+		}
+		time.Sleep(c.Duration("interval"))
+	}
+}
+
+// topRows sums the tasks of the apps filter selects. The headroom of a
+// user is its quota in cluster minus what all of its apps use.
+func topRows(apps []*types.App, filter *appFilter, quotas Quota, cluster string) []*topRow {
+	used := &clusterUsage{Users: make(map[string]*usage)}
+	for _, app := range apps {
+		used.add(app)
+	}
+
+	var rows []*topRow
+	for _, app := range apps {
+		if !filter.matches(app) {
+			continue
+		}
+
+		row := &topRow{
+			App:       app.ID,
+			User:      app.RunAs,
+			Instances: app.Instances,
+			Checked:   app.CurrentVersion != nil && len(app.CurrentVersion.HealthChecks) > 0,
+		}
+		for _, task := range app.Tasks {
+			if taskReady(task, false) {
+				row.Running++
+			}
+			if row.Checked && taskReady(task, true) {
+				row.Healthy++
+			}
+			row.Cpu += task.Cpu
+			row.Mem += task.Mem
+			row.Disk += task.Disk
+		}
+
+		if q := quotas[app.RunAs][cluster]; q != nil {
+			u := used.user(app.RunAs)
+			cpu, mem := q.Cpu-u.Cpu, q.Memory-u.Mem
+			row.CpuLeft, row.MemLeft = &cpu, &mem
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func sortTopRows(rows []*topRow, column *topColumn, reverse bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if reverse {
+			a, b = b, a
+		}
+
+		if column.numeric {
+			if va, vb := column.value(a), column.value(b); va != vb {
+				return va > vb
+			}
+		} else if ta, tb := column.text(a), column.text(b); ta != tb {
+			return ta < tb
+		}
+
+		return a.App < b.App
+	})
+}
+
+func printTopTable(w io.Writer, rows []*topRow, cluster string, now time.Time) {
+	var tasks int
+	var cpu, mem, disk float64
+	for _, row := range rows {
+		tasks += row.Running
+		cpu += row.Cpu
+		mem += row.Mem
+		disk += row.Disk
+	}
+
+	fmt.Fprintf(w, "swancfg top - %s  cluster: %s\n", now.Format("15:04:05"), cluster)
+	fmt.Fprintf(w, "Apps: %d  Running tasks: %d  Cpu: %.2f  Mem: %.f  Disk: %.f\n\n", len(rows), tasks, cpu, mem, disk)
+
+	t := newOutputTable(
+		"APP",
+		"USER",
+		"INSTANCES",
+		"RUNNING",
+		"HEALTHY",
+		"CPU",
+		"MEM",
+		"DISK",
+		"CPU LEFT",
+		"MEM LEFT",
+	)
+	for _, row := range rows {
+		healthy := "-"
+		if row.Checked {
+			healthy = fmt.Sprintf("%d", row.Healthy)
+		}
+
+		t.append(
+			row.App,
+			row.User,
+			fmt.Sprintf("%d", row.Instances),
+			fmt.Sprintf("%d", row.Running),
+			healthy,
+			fmt.Sprintf("%.2f", row.Cpu),
+			fmt.Sprintf("%.f", row.Mem),
+			fmt.Sprintf("%.f", row.Disk),
+			formatLeft(row.CpuLeft, "%.2f"),
+			formatLeft(row.MemLeft, "%.f"),
+		)
+	}
+	t.render(w, false, true)
+}
+
+// printTopLines prints a line of key=value pairs per app, for logs and
+// pipes.
+func printTopLines(w io.Writer, rows []*topRow, now time.Time) {
+	for _, row := range rows {
+		healthy := "-"
+		if row.Checked {
+			healthy = fmt.Sprintf("%d", row.Healthy)
+		}
+
+		fmt.Fprintf(w, "%s app=%s user=%s instances=%d running=%d healthy=%s cpu=%.2f mem=%.f disk=%.f cpu_left=%s mem_left=%s\n",
+			now.Format(time.RFC3339),
+			row.App,
+			row.User,
+			row.Instances,
+			row.Running,
+			healthy,
+			row.Cpu,
+			row.Mem,
+			row.Disk,
+			formatLeft(row.CpuLeft, "%.2f"),
+			formatLeft(row.MemLeft, "%.f"),
+		)
+	}
+}
+
+func formatLeft(left *float64, format string) string {
+	if left == nil {
+		return "-"
+	}
+
+	return fmt.Sprintf(format, *left)
+}
+
+// leftValue sorts users without quota as if they had the most left.
+func leftValue(left *float64) float64 {
+	if left == nil {
+		return 1e18
+	}
+
+	return *left
+}
+
+func findTopColumn(name string) *topColumn {
+	for _, column := range topColumns {
+		if column.Name == name {
+			return column
+		}
+	}
+
+	return nil
+}
+
+func topColumnNames() []string {
+	var names []string
+	for _, column := range topColumns {
+		names = append(names, column.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,250 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/urfave/cli"
+)
+
+const updateActionRollback = "rollback"
+
+// defaultUpdatePolicy is followed by updates of specs without an update
+// policy: a few restarts and slow instances are tolerated, and the update
+// isn't rolled back.
+var defaultUpdatePolicy = types.UpdatePolicy{
+	MaxRetries:   3,
+	MaxFailovers: 3,
+}
+
+// NewUpdateCommand returns the CLI command for "update"
+func NewUpdateCommand() cli.Command {
+	return cli.Command{
+		Name:  "update",
+		Usage: "rolling update application to a new version",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "from-file, f",
+				Usage: "Update application from `FILE` in json, yaml or toml, - for stdin",
+			},
+			cli.StringFlag{
+				Name:  "name, n",
+				Usage: "Set application name",
+			},
+			cli.DurationFlag{
+				Name:  "wait",
+				Value: time.Minute,
+				Usage: "Time to wait for each updated instance to become healthy",
+			},
+		}, templateFlags()...),
+		Action: func(c *cli.Context) error {
+			if err := updateApplication(c); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// rollout follows a rolling update of one app, applying its update policy
+// on the client side.
+type rollout struct {
+	swan   *client.Client
+	appId  string
+	policy types.UpdatePolicy
+	wait   time.Duration
+
+	// versions the app ran before the update; tasks with any other
+	// version belong to the update.
+	previous map[string]bool
+	checked  bool
+	total    int
+}
+
+// updateApplication executes the "update" command.
+func updateApplication(c *cli.Context) error {
+	if c.String("from-file") == "" {
+		return fmt.Errorf("Spec file must be specified for updating application")
+	}
+
+	spec, err := loadValidSpec(c)
+	if err != nil {
+		return err
+	}
+
+	if name := c.String("name"); name != "" {
+		spec.AppName = name
+	}
+
+	if err := completeSpec(spec); err != nil {
+		return err
+	}
+
+	swan, err := clusterClient(spec.Cluster)
+	if err != nil {
+		return err
+	}
+
+	appId := specAppID(spec)
+	app, err := swan.GetApp(context.Background(), appId)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return fmt.Errorf("app %s not found, use run to create it", appId)
+		}
+		return err
+	}
+
+	return newRollout(swan, app, spec, c.Duration("wait")).run(spec)
+}
+
+// newRollout prepares moving app to spec.
+func newRollout(swan *client.Client, app *types.App, spec *types.Spec, wait time.Duration) *rollout {
+	r := &rollout{
+		swan:     swan,
+		appId:    app.ID,
+		policy:   defaultUpdatePolicy,
+		wait:     wait,
+		previous: make(map[string]bool),
+		checked:  len(spec.HealthChecks) > 0,
+		total:    int(spec.Instances),
+	}
+	if spec.UpdatePolicy != nil {
+		r.policy = *spec.UpdatePolicy
+	}
+	for _, task := range app.Tasks {
+		r.previous[task.VersionId] = true
+	}
+	if r.total == 0 {
+		r.total = app.Instances
+	}
+
+	return r
+}
+
+func (r *rollout) run(spec *types.Spec) error {
+	ctx := context.Background()
+
+	fmt.Printf("===> sending new version of %s to cluster:%s...", r.appId, spec.Cluster)
+	if err := r.swan.UpdateApp(ctx, r.appId, spec); err != nil {
+		fmt.Println("failed")
+		return err
+	}
+	fmt.Println("done")
+
+	for updated := 1; ; updated++ {
+		if err := r.waitStep(updated); err != nil {
+			return r.fail(err)
+		}
+
+		if updated >= r.total {
+			fmt.Printf("===> application %s updated\n", r.appId)
+			return nil
+		}
+
+		if r.policy.UpdateDelay > 0 {
+			time.Sleep(time.Duration(r.policy.UpdateDelay) * time.Second)
+		}
+
+		if err := r.swan.ProceedUpdate(ctx, r.appId, 1); err != nil {
+			return r.fail(err)
+		}
+	}
+}
+
+// waitStep waits until updated instances run the new version and are
+// healthy, retrying up to MaxRetries times and giving up once more than
+// MaxFailovers new tasks have failed.
+func (r *rollout) waitStep(updated int) error {
+	for retry := 0; ; retry++ {
+		fmt.Printf("===> waiting for %d/%d instances to be updated...", updated, r.total)
+
+		var failovers int
+		ok, err := waitFor(r.wait, func() (bool, error) {
+			fmt.Printf(".")
+			app, err := r.swan.GetApp(context.Background(), r.appId)
+			if err != nil {
+				return false, err
+			}
+
+			var ready int
+			failovers = 0
+			for _, task := range app.Tasks {
+				if r.previous[task.VersionId] {
+					continue
+				}
+				failovers += len(task.History)
+				if taskReady(task, r.checked) {
+					ready++
+				}
+			}
+
+			if failovers > int(r.policy.MaxFailovers) {
+				return false, fmt.Errorf("%d failovers exceed the limit of %d", failovers, r.policy.MaxFailovers)
+			}
+
+			return app.UpdatedInstances >= updated && ready >= updated, nil
+		})
+		if err != nil {
+			fmt.Println("failed")
+			return err
+		}
+
+		if ok {
+			fmt.Println("done")
+			return nil
+		}
+
+		fmt.Println("timeout")
+		if retry >= int(r.policy.MaxRetries) {
+			return fmt.Errorf("instances not healthy after %d retries", retry)
+		}
+	}
+}
+
+// fail reports a failed update and rolls it back when the update policy
+// asks for it.
+func (r *rollout) fail(cause error) error {
+	if r.policy.Action != updateActionRollback {
+		return fmt.Errorf("update of %s failed: %s", r.appId, cause.Error())
+	}
+
+	fmt.Printf("===> update failed: %s\n", cause.Error())
+	fmt.Printf("===> rolling back %s...", r.appId)
+	if err := r.swan.CancelUpdate(context.Background(), r.appId); err != nil {
+		fmt.Println("failed")
+		return fmt.Errorf("update of %s failed: %s, rollback failed: %s", r.appId, cause.Error(), err.Error())
+	}
+
+	ok, err := waitFor(r.wait, func() (bool, error) {
+		fmt.Printf(".")
+		app, err := r.swan.GetApp(context.Background(), r.appId)
+		if err != nil {
+			return false, err
+		}
+
+		for _, task := range app.Tasks {
+			if !r.previous[task.VersionId] {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		fmt.Println("failed")
+		return err
+	}
+
+	if !ok {
+		fmt.Println("timeout")
+		return fmt.Errorf("update of %s failed: %s, rollback still in progress", r.appId, cause.Error())
+	}
+
+	fmt.Println("done")
+	return fmt.Errorf("update of %s failed: %s, rolled back", r.appId, cause.Error())
+}
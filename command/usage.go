@@ -0,0 +1,318 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Dataman-Cloud/swancfg/client"
+	"github.com/Dataman-Cloud/swancfg/types"
+)
+
+var (
+	// usageTTL is how long the usage of a cluster is cached in the store.
+	// Zero disables the cache.
+	usageTTL time.Duration
+
+	// usageWorkers bounds the concurrent requests getting apps of one
+	// cluster.
+	usageWorkers = 8
+)
+
+// usage is what the apps of one user consume in one cluster.
+type usage struct {
+	Cpu       float64 `json:"cpu"`
+	Mem       float64 `json:"mem"`
+	Disk      float64 `json:"disk"`
+	Apps      int     `json:"apps"`
+	Instances int     `json:"instances"`
+	Tasks     int     `json:"tasks"`
+}
+
+// clusterUsage is the usage of every user of a cluster at some time.
+type clusterUsage struct {
+	Time  time.Time         `json:"time"`
+	Users map[string]*usage `json:"users"`
+}
+
+func (u *clusterUsage) add(app *types.App) {
+	used := u.entry(app.RunAs)
+
+	used.Apps++
+	used.Instances += app.Instances
+	for _, task := range app.Tasks {
+		used.Tasks++
+		used.Cpu += task.Cpu
+		used.Mem += task.Mem
+		used.Disk += task.Disk
+	}
+}
+
+// declare adds what app asks for rather than what its tasks use: its
+// current version times its instances. Apps swan just accepted count in
+// full before any of their tasks is launched.
+func (u *clusterUsage) declare(app *types.App) {
+	spec := app.CurrentVersion
+	if spec == nil {
+		u.add(app)
+		return
+	}
+
+	used := u.entry(app.RunAs)
+
+	n := float64(app.Instances)
+	used.Apps++
+	used.Instances += app.Instances
+	used.Tasks += len(app.Tasks)
+	used.Cpu += n * spec.Cpus
+	used.Mem += n * spec.Mem
+	used.Disk += n * spec.Disk
+}
+
+// entry returns the usage of user to add to.
+func (u *clusterUsage) entry(name string) *usage {
+	used, ok := u.Users[name]
+	if !ok {
+		used = &usage{}
+		u.Users[name] = used
+	}
+
+	return used
+}
+
+// user returns the usage of user, which is zero when it runs no app.
+func (u *clusterUsage) user(name string) *usage {
+	if used, ok := u.Users[name]; ok {
+		return used
+	}
+
+	return &usage{}
+}
+
+// fetchUsage computes the usage of the apps in cluster filter selects.
+func fetchUsage(cluster string, filter *appFilter) (*clusterUsage, error) {
+	swan, err := clusterClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchSwanUsage(swan, filter)
+}
+
+// fetchSwanUsage computes the usage of the apps served by swan filter
+// selects.
+func fetchSwanUsage(swan *client.Client, filter *appFilter) (*clusterUsage, error) {
+	apps, err := fetchApps(swan, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &clusterUsage{Time: time.Now(), Users: make(map[string]*usage)}
+	for _, app := range apps {
+		result.add(app)
+	}
+
+	return result, nil
+}
+
+// fetchDeclaredUsage computes the usage the apps served by swan filter
+// selects declare.
+func fetchDeclaredUsage(swan *client.Client, filter *appFilter) (*clusterUsage, error) {
+	apps, err := fetchApps(swan, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &clusterUsage{Time: time.Now(), Users: make(map[string]*usage)}
+	for _, app := range apps {
+		result.declare(app)
+	}
+
+	return result, nil
+}
+
+// fetchApps returns the apps of swan filter selects, with their tasks. The
+// apps are listed once and then got by a pool of usageWorkers.
+func fetchApps(swan *client.Client, filter *appFilter) ([]*types.App, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apps, err := swan.ListApps(ctx, filter.options())
+	if err != nil {
+		return nil, fmt.Errorf("Get apps failed: %s", err.Error())
+	}
+
+	workers := usageWorkers
+	if workers > len(apps) {
+		workers = len(apps)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		details  []*types.App
+		ids      = make(chan string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				detail, err := swan.GetApp(ctx, id)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					if filter.matches(detail) {
+						details = append(details, detail)
+					}
+				case client.IsNotFound(err):
+					// Deleted since it was listed.
+				case firstErr == nil:
+					firstErr = fmt.Errorf("Get app %s failed: %s", id, err.Error())
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, app := range apps {
+		select {
+		case ids <- app.ID:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(ids)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return details, nil
+}
+
+// usageAggregator holds the usage of whole clusters, each fetched once.
+type usageAggregator struct {
+	clusters map[string]*clusterUsage
+	errs     map[string]error
+}
+
+// aggregateUsage gets the usage of every user of clusters by the apps
+// filter selects, concurrently. Clusters cached in the store for less than
+// usageTTL aren't fetched; the cache only holds the usage of every app.
+func aggregateUsage(clusters []string, filter *appFilter) *usageAggregator {
+	a := &usageAggregator{
+		clusters: make(map[string]*clusterUsage),
+		errs:     make(map[string]error),
+	}
+
+	cache := usageTTL > 0 && filter.empty()
+
+	missing := clusters
+	if cache {
+		missing = a.loadCache(clusters)
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, cluster := range missing {
+		wg.Add(1)
+		go func(cluster string) {
+			defer wg.Done()
+			used, err := fetchUsage(cluster, filter)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				a.errs[cluster] = err
+				return
+			}
+			a.clusters[cluster] = used
+		}(cluster)
+	}
+	wg.Wait()
+
+	if cache {
+		a.saveCache(missing)
+	}
+
+	return a
+}
+
+// used returns the usage of user in cluster.
+func (a *usageAggregator) used(user, cluster string) (*usage, error) {
+	if err, ok := a.errs[cluster]; ok {
+		return &usage{}, err
+	}
+
+	used, ok := a.clusters[cluster]
+	if !ok {
+		return &usage{}, fmt.Errorf("usage of cluster %s not fetched", cluster)
+	}
+
+	return used.user(user), nil
+}
+
+// loadCache takes the fresh enough clusters from the store and returns
+// the others.
+func (a *usageAggregator) loadCache(clusters []string) []string {
+	store, err := openStore()
+	if err != nil {
+		return clusters
+	}
+	defer store.Close()
+
+	var missing []string
+	for _, cluster := range clusters {
+		used, err := store.GetUsage(cluster)
+		if err != nil || used == nil || time.Since(used.Time) > usageTTL {
+			missing = append(missing, cluster)
+			continue
+		}
+		a.clusters[cluster] = used
+	}
+
+	return missing
+}
+
+// saveCache stores the usage fetched for clusters.
+func (a *usageAggregator) saveCache(clusters []string) {
+	store, err := openStore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: cache usage failed:", err)
+		return
+	}
+	defer store.Close()
+
+	for _, cluster := range clusters {
+		if used, ok := a.clusters[cluster]; ok {
+			if err := store.PutUsage(cluster, used); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: cache usage failed:", err)
+				return
+			}
+		}
+	}
+}
+
+// getUsedQuota returns the resources used by user in cluster. It is
+// always fetched fresh, quota checks must not work on a cached usage.
+func getUsedQuota(user, cluster string) (*usage, error) {
+	used, err := fetchUsage(cluster, userFilter(user))
+	if err != nil {
+		return nil, err
+	}
+
+	return used.user(user), nil
+}
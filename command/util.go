@@ -2,70 +2,266 @@ package command
 
 import (
 	"fmt"
-	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/Dataman-Cloud/swancfg/client"
 	"github.com/Dataman-Cloud/swancfg/types"
-	"gopkg.in/yaml.v2"
+	"github.com/urfave/cli"
 )
 
-func getRemotes() (map[string]string, error) {
-	db, err := NewBoltStore(".bolt.db")
+var (
+	requestTimeout = client.DefaultTimeout
+	storePath      = defaultStorePath()
+)
+
+// GlobalFlags returns the flags shared by every command.
+func GlobalFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: client.DefaultTimeout,
+			Usage: "Timeout for a single request to swan",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Value:  defaultStorePath(),
+			Usage:  "Path of the swancfg store holding contexts",
+			EnvVar: "SWANCFG_CONFIG",
+		},
+		cli.DurationFlag{
+			Name:   "usage-ttl",
+			Usage:  "Cache the resource usage of clusters for quota listings this long",
+			EnvVar: "SWANCFG_USAGE_TTL",
+		},
+		cli.StringFlag{
+			Name:   "audit-log",
+			Usage:  "Also append audit records to this JSON lines file",
+			EnvVar: "SWANCFG_AUDIT_LOG",
+		},
+		cli.IntFlag{
+			Name:  "workers",
+			Value: usageWorkers,
+			Usage: "Concurrent requests to one swan when computing resource usage",
+		},
+	}
+}
+
+// Before applies the global flags before any command runs.
+func Before(c *cli.Context) error {
+	if c.GlobalDuration("timeout") > 0 {
+		requestTimeout = c.GlobalDuration("timeout")
+	}
+
+	if c.GlobalString("config") != "" {
+		storePath = c.GlobalString("config")
+	}
+
+	auditLogPath = c.GlobalString("audit-log")
+	auditCommand = auditCommandLine(c.App, c.Args())
+
+	usageTTL = c.GlobalDuration("usage-ttl")
+	if c.GlobalInt("workers") > 0 {
+		usageWorkers = c.GlobalInt("workers")
+	}
+
+	return nil
+}
+
+func defaultStorePath() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		if u, err := user.Current(); err == nil {
+			home = u.HomeDir
+		}
+	}
+
+	return filepath.Join(home, ".swancfg", "swancfg.db")
+}
+
+// openStore opens the swancfg store, importing the legacy cluster.cfg and
+// .bolt.db on first use. Callers must close it.
+func openStore() (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(storePath), 0700); err != nil {
+		return nil, fmt.Errorf("Init store engine failed:%s", err)
+	}
+
+	store, err := NewBoltStore(storePath)
 	if err != nil {
 		return nil, fmt.Errorf("Init store engine failed:%s", err)
 	}
 
-	tx, err := db.conn.Begin(true)
+	if err := importLegacyOnce(store); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: import legacy clusters failed:", err)
+	}
+
+	if err := importLegacyQuotasOnce(store); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: import legacy quotas failed:", err)
+	}
+
+	return store, nil
+}
+
+// getCluster resolves a context by name. An empty name means the current
+// context.
+func getCluster(name string) (*Cluster, error) {
+	store, err := openStore()
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	defer store.Close()
+
+	if name == "" {
+		name, err = store.CurrentCluster()
+		if err != nil {
+			return nil, err
+		}
 
-	bucket := tx.Bucket([]byte("swan"))
+		if name == "" {
+			return nil, fmt.Errorf("no current context, add one with: swancfg context add")
+		}
+	}
 
-	c := bucket.Cursor()
+	cluster, err := store.GetCluster(name)
+	if err != nil {
+		return nil, err
+	}
 
-	remotes := make(map[string]string)
-	for k, v := c.First(); k != nil; k, v = c.Next() {
-		remotes[string(k)] = string(v)
+	if cluster == nil {
+		return nil, fmt.Errorf("context %s not found", name)
 	}
 
-	return remotes, nil
+	return cluster, nil
 }
 
-func getRemote(remote string) (string, error) {
-	db, err := NewBoltStore(".bolt.db")
+func newClient(cluster *Cluster) *client.Client {
+	return client.New(cluster.Swan,
+		client.WithTimeout(requestTimeout),
+		client.WithBasicAuth(cluster.Username, cluster.Password),
+		client.WithObserver(auditObserver(cluster)),
+	)
+}
+
+// swanClient returns a client for the current context.
+func swanClient() (*client.Client, error) {
+	return clusterClient("")
+}
+
+// clusterClient returns a client for the swan serving cluster. An empty
+// cluster means the current context.
+func clusterClient(cluster string) (*client.Client, error) {
+	target, err := getCluster(cluster)
 	if err != nil {
-		return "", fmt.Errorf("Init store engine failed:%s", err)
+		return nil, err
+	}
+
+	if target.Swan == "" {
+		return nil, fmt.Errorf("swan address of context %s not set", target.Name)
 	}
 
-	tx, err := db.conn.Begin(false)
+	return newClient(target), nil
+}
+
+// appClient returns a client for the swan running appId. An explicit
+// cluster wins, then the context named after the cluster part of the id,
+// then the current context.
+func appClient(appId, cluster string) (*client.Client, error) {
+	target, err := getAppCluster(appId, cluster)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if target.Swan == "" {
+		return nil, fmt.Errorf("swan address of context %s not set", target.Name)
 	}
-	defer tx.Rollback()
 
-	bucket := tx.Bucket([]byte("swan"))
-	val := bucket.Get([]byte(remote))
+	return newClient(target), nil
+}
 
-	if val == nil {
-		return "", nil
+// getAppCluster resolves the context of appId the same way appClient does.
+func getAppCluster(appId, cluster string) (*Cluster, error) {
+	if cluster == "" {
+		if c, _ := getCluster(appCluster(appId)); c != nil {
+			return c, nil
+		}
 	}
 
-	return string(val[:]), nil
+	return getCluster(cluster)
 }
 
-type Quota map[string]map[string]*types.Quota
+// mesosClient returns a client for the mesos master of cluster.
+func mesosClient(cluster *Cluster) (*client.Mesos, error) {
+	if cluster.Mesos == "" {
+		return nil, fmt.Errorf("mesos address of context %s not set", cluster.Name)
+	}
 
-func getQuotas() (Quota, error) {
-	file, err := ioutil.ReadFile("./quota.yml")
-	if err != nil {
-		return nil, fmt.Errorf("Read quota file failed: %s", err.Error())
+	return client.NewMesos(cluster.Mesos,
+		client.WithTimeout(requestTimeout),
+		client.WithBasicAuth(cluster.Username, cluster.Password),
+	), nil
+}
+
+// appCluster returns the cluster part of an app id of the form
+// name-user-cluster.
+func appCluster(appId string) string {
+	parts := strings.Split(appId, "-")
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[len(parts)-1]
+}
+
+// waitFor calls check every second until it reports done or fails, or
+// until timeout elapses. It reports whether check finished in time.
+func waitFor(timeout time.Duration, check func() (bool, error)) (bool, error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			done, err := check()
+			if err != nil || done {
+				return done, err
+			}
+		case <-deadline.C:
+			return false, nil
+		}
 	}
-	entries := make(map[string]map[string]*types.Quota)
+}
+
+// taskReady reports whether task is running and, when the app defines
+// health checks, healthy.
+func taskReady(task *types.Task, checked bool) bool {
+	if task.Status != "slot_task_running" {
+		return false
+	}
+
+	return !checked || task.Healthy
+}
+
+// taskFailed reports whether a task or mesos state means the task died.
+func taskFailed(state string) bool {
+	state = strings.ToLower(state)
+	for _, s := range []string{"failed", "error", "lost", "dropped", "gone"} {
+		if strings.HasSuffix(state, s) {
+			return true
+		}
+	}
+
+	return false
+}
 
-	if err := yaml.Unmarshal(file, entries); err != nil {
-		return nil, fmt.Errorf("Unmarshal failed: %s", err.Error())
+func positive(f float64) float64 {
+	if f < 0 {
+		return 0
 	}
 
-	return entries, nil
+	return f
 }
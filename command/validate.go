@@ -0,0 +1,554 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Dataman-Cloud/swancfg/types"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+var (
+	specModes        = []string{"replicates", "fixed"}
+	dockerNetworks   = []string{"bridge", "host", "none"}
+	portProtocols    = []string{"tcp", "udp"}
+	healthProtocols  = []string{"http", "tcp", "cmd"}
+	volumeModes      = []string{"RO", "RW"}
+	updatePolicyActs = []string{"", "stop", updateActionRollback}
+)
+
+// NewValidateCommand returns the CLI command for "validate"
+func NewValidateCommand() cli.Command {
+	return cli.Command{
+		Name:  "validate",
+		Usage: "validate application spec",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "from-file, f",
+				Usage: "Validate application spec in `FILE`, - for stdin",
+			},
+		}, templateFlags()...),
+		Action: func(c *cli.Context) error {
+			valid, err := validateSpecFile(c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			if err != nil || !valid {
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+// specProblem is one issue found in a spec, located by its JSON path.
+type specProblem struct {
+	Path     string `json:"path"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// validateSpecFile executes the "validate" command.
+func validateSpecFile(c *cli.Context) (bool, error) {
+	if c.String("from-file") == "" {
+		return false, fmt.Errorf("Spec file must be specified for validating application")
+	}
+
+	vars, err := specVars(c)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := readSpec(c.String("from-file"), vars)
+	if err != nil {
+		return false, err
+	}
+
+	problems := validateSpec(f)
+	if len(problems) == 0 {
+		fmt.Printf("%s is valid\n", f.Name())
+		return true, nil
+	}
+
+	printProblemTable(problems)
+
+	return !hasErrors(problems), nil
+}
+
+// loadValidSpec reads the spec file given to c and refuses it if
+// validation finds any error. Warnings are printed and let through.
+func loadValidSpec(c *cli.Context) (*types.Spec, error) {
+	vars, err := specVars(c)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := readValidSpec(c.String("from-file"), vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Spec()
+}
+
+// readValidSpec reads the spec file at path and refuses it if validation
+// finds any error.
+func readValidSpec(path string, vars map[string]string) (*specFile, error) {
+	f, err := readSpec(path, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := validateSpec(f)
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "===> validating %s...\n", f.Name())
+		printProblems(os.Stderr, problems)
+	}
+
+	if hasErrors(problems) {
+		return nil, fmt.Errorf("Spec %s is invalid, check it with: swancfg validate -f %s", f.Name(), f.Path)
+	}
+
+	return f, nil
+}
+
+func hasErrors(problems []*specProblem) bool {
+	for _, p := range problems {
+		if p.Severity == severityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+func printProblems(w io.Writer, problems []*specProblem) {
+	for _, p := range problems {
+		fmt.Fprintf(w, "  %-7s  %s: %s\n", p.Severity, p.Path, p.Message)
+	}
+}
+
+func printProblemTable(problems []*specProblem) {
+	tb := tablewriter.NewWriter(os.Stdout)
+	tb.SetHeader([]string{
+		"SEVERITY",
+		"PATH",
+		"MESSAGE",
+	})
+	tb.SetAutoWrapText(false)
+	for _, p := range problems {
+		tb.Append([]string{
+			p.Severity,
+			p.Path,
+			p.Message,
+		})
+	}
+	tb.Render()
+}
+
+// specValidator collects the problems of one spec.
+type specValidator struct {
+	problems []*specProblem
+}
+
+// validateSpec checks the document of f against the shape of types.Spec,
+// then the decoded spec against what swan accepts.
+func validateSpec(f *specFile) []*specProblem {
+	v := &specValidator{}
+
+	v.checkDoc("$", f.Doc, reflect.TypeOf(types.Spec{}))
+	if hasErrors(v.problems) {
+		return v.problems
+	}
+
+	spec, err := f.Spec()
+	if err != nil {
+		v.errorf("$", "%s", err.Error())
+		return v.problems
+	}
+
+	v.checkSpec(spec)
+
+	return v.problems
+}
+
+func (v *specValidator) errorf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, &specProblem{
+		Path:     path,
+		Severity: severityError,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *specValidator) warnf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, &specProblem{
+		Path:     path,
+		Severity: severityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkDoc walks a generic document along the Go type it decodes into,
+// reporting unknown fields and values of the wrong type.
+func (v *specValidator) checkDoc(path string, val interface{}, t reflect.Type) {
+	if val == nil {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			v.errorf(path, "expected an object, got %s", docKind(val))
+			return
+		}
+
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, ok := lookupField(t, key)
+			if !ok {
+				v.warnf(path+"."+key, "unknown field %q is ignored%s", key, suggestField(t, key))
+				continue
+			}
+			v.checkDoc(path+"."+key, m[key], field.Type)
+		}
+	case reflect.Slice:
+		list, ok := val.([]interface{})
+		if !ok {
+			v.errorf(path, "expected an array, got %s", docKind(val))
+			return
+		}
+
+		for i, item := range list {
+			v.checkDoc(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+		}
+	case reflect.Map:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			v.errorf(path, "expected an object, got %s", docKind(val))
+			return
+		}
+
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			v.checkDoc(path+"."+key, m[key], t.Elem())
+		}
+	case reflect.String:
+		if _, ok := val.(string); !ok {
+			v.errorf(path, "expected a string, got %s", docKind(val))
+		}
+	case reflect.Bool:
+		if _, ok := val.(bool); !ok {
+			v.errorf(path, "expected a boolean, got %s", docKind(val))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := val.(json.Number)
+		if !ok {
+			v.errorf(path, "expected an integer, got %s", docKind(val))
+		} else if _, err := n.Int64(); err != nil {
+			v.errorf(path, "expected an integer, got %s", n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := val.(json.Number)
+		if !ok {
+			v.errorf(path, "expected an integer, got %s", docKind(val))
+		} else if i, err := n.Int64(); err != nil || i < 0 {
+			v.errorf(path, "expected a non-negative integer, got %s", n)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := val.(json.Number); !ok {
+			v.errorf(path, "expected a number, got %s", docKind(val))
+		}
+	}
+}
+
+// checkSpec reports the values swan would reject or silently ignore.
+func (v *specValidator) checkSpec(spec *types.Spec) {
+	if spec.AppName == "" {
+		v.errorf("$.appName", "application name required")
+	}
+
+	if spec.Instances < 0 {
+		v.errorf("$.instances", "must not be negative, got %d", spec.Instances)
+	} else if spec.Instances == 0 {
+		v.warnf("$.instances", "no instance will be started")
+	}
+
+	if spec.Cpus <= 0 {
+		v.errorf("$.cpus", "must be positive, got %g", spec.Cpus)
+	}
+	if spec.Mem <= 0 {
+		v.errorf("$.mem", "must be positive, got %g", spec.Mem)
+	}
+	if spec.Disk < 0 {
+		v.errorf("$.disk", "must not be negative, got %g", spec.Disk)
+	}
+	if spec.Priority < 0 {
+		v.errorf("$.priority", "must not be negative, got %d", spec.Priority)
+	}
+
+	if spec.Mode != "" && !oneOf(spec.Mode, specModes, false) {
+		v.errorf("$.mode", "unknown mode %q, expected one of %s", spec.Mode, strings.Join(specModes, ", "))
+	}
+	if spec.Mode == "fixed" && len(spec.Ip) != int(spec.Instances) {
+		v.errorf("$.ip", "fixed mode needs one ip per instance, got %d for %d instances", len(spec.Ip), spec.Instances)
+	}
+
+	for key := range spec.Env {
+		if key == "" {
+			v.errorf("$.env", "empty variable name")
+		}
+	}
+
+	ports := v.checkContainer(spec.Container)
+	v.checkHealthChecks(spec.HealthChecks, ports)
+
+	if spec.KillPolicy != nil && spec.KillPolicy.Duration < 0 {
+		v.errorf("$.killPolicy.duration", "must not be negative, got %d", spec.KillPolicy.Duration)
+	}
+
+	if p := spec.UpdatePolicy; p != nil {
+		if p.UpdateDelay < 0 {
+			v.errorf("$.updatePolicy.updateDelay", "must not be negative, got %d", p.UpdateDelay)
+		}
+		if p.MaxRetries < 0 {
+			v.errorf("$.updatePolicy.maxRetries", "must not be negative, got %d", p.MaxRetries)
+		}
+		if p.MaxFailovers < 0 {
+			v.errorf("$.updatePolicy.maxFailovers", "must not be negative, got %d", p.MaxFailovers)
+		}
+		if !oneOf(p.Action, updatePolicyActs, false) {
+			v.errorf("$.updatePolicy.action", "unknown action %q, expected stop or rollback", p.Action)
+		}
+	}
+}
+
+// checkContainer validates the docker container and returns the names of
+// its port mappings.
+func (v *specValidator) checkContainer(container *types.Container) map[string]bool {
+	ports := make(map[string]bool)
+
+	if container == nil {
+		v.errorf("$.container", "container required")
+		return ports
+	}
+
+	if !oneOf(container.Type, []string{"DOCKER"}, true) {
+		v.errorf("$.container.type", "unsupported container type %q, only DOCKER is supported", container.Type)
+	}
+
+	for i, vol := range container.Volumes {
+		path := fmt.Sprintf("$.container.volumes[%d]", i)
+		if vol.ContainerPath == "" {
+			v.errorf(path+".containerPath", "container path required")
+		}
+		if vol.HostPath == "" {
+			v.errorf(path+".hostPath", "host path required")
+		}
+		if !oneOf(vol.Mode, volumeModes, true) {
+			v.errorf(path+".mode", "unknown mode %q, expected RO or RW", vol.Mode)
+		}
+	}
+
+	docker := container.Docker
+	if docker == nil {
+		v.errorf("$.container.docker", "docker required")
+		return ports
+	}
+
+	if docker.Image == "" {
+		v.errorf("$.container.docker.image", "image required")
+	}
+
+	if docker.Network != "" && !oneOf(docker.Network, dockerNetworks, true) {
+		v.warnf("$.container.docker.network", "%q is not one of %s, it must be a user defined network", docker.Network, strings.Join(dockerNetworks, ", "))
+	}
+
+	for i, param := range docker.Parameters {
+		if param.Key == "" {
+			v.errorf(fmt.Sprintf("$.container.docker.parameters[%d].key", i), "parameter key required")
+		}
+	}
+
+	for i, pm := range docker.PortMappings {
+		path := fmt.Sprintf("$.container.docker.portMappings[%d]", i)
+		if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
+			v.errorf(path+".containerPort", "must be between 1 and 65535, got %d", pm.ContainerPort)
+		}
+		if pm.Protocol != "" && !oneOf(pm.Protocol, portProtocols, true) {
+			v.errorf(path+".protocol", "unknown protocol %q, expected tcp or udp", pm.Protocol)
+		}
+		if pm.Name == "" {
+			v.warnf(path+".name", "unnamed port can't be used by health checks")
+			continue
+		}
+		if ports[pm.Name] {
+			v.errorf(path+".name", "duplicate port name %q", pm.Name)
+		}
+		ports[pm.Name] = true
+	}
+
+	return ports
+}
+
+func (v *specValidator) checkHealthChecks(checks []*types.HealthCheck, ports map[string]bool) {
+	for i, hc := range checks {
+		path := fmt.Sprintf("$.healthChecks[%d]", i)
+		if hc == nil {
+			continue
+		}
+
+		if !oneOf(hc.Protocol, healthProtocols, true) {
+			v.errorf(path+".protocol", "unknown protocol %q, expected one of %s", hc.Protocol, strings.Join(healthProtocols, ", "))
+		}
+
+		if strings.EqualFold(hc.Protocol, "http") && hc.Path == "" {
+			v.warnf(path+".path", "not set, / is checked")
+		}
+
+		if !strings.EqualFold(hc.Protocol, "cmd") {
+			if hc.PortName == "" {
+				v.errorf(path+".portName", "port name required")
+			} else if !ports[hc.PortName] {
+				v.errorf(path+".portName", "no port mapping named %q", hc.PortName)
+			}
+		}
+
+		if hc.IntervalSeconds < 0 {
+			v.errorf(path+".intervalSeconds", "must not be negative, got %g", hc.IntervalSeconds)
+		}
+		if hc.TimeoutSeconds < 0 {
+			v.errorf(path+".timeoutSeconds", "must not be negative, got %g", hc.TimeoutSeconds)
+		}
+		if hc.IntervalSeconds > 0 && hc.TimeoutSeconds > hc.IntervalSeconds {
+			v.warnf(path+".timeoutSeconds", "longer than intervalSeconds, checks will overlap")
+		}
+		if hc.GracePeriodSeconds < 0 {
+			v.errorf(path+".gracePeriodSeconds", "must not be negative, got %g", hc.GracePeriodSeconds)
+		}
+	}
+}
+
+// lookupField finds the struct field a key decodes into, following the
+// case-insensitive matching of encoding/json.
+func lookupField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if strings.EqualFold(fieldName(field), key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// fieldName returns the name a field has in spec files.
+func fieldName(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" {
+		return tag
+	}
+
+	return strings.ToLower(field.Name[:1]) + field.Name[1:]
+}
+
+// suggestField proposes the field of t closest to an unknown key.
+func suggestField(t reflect.Type, key string) string {
+	best, bestDist := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		name := fieldName(t.Field(i))
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+
+	return a
+}
+
+func oneOf(val string, allowed []string, fold bool) bool {
+	for _, a := range allowed {
+		if val == a || (fold && strings.EqualFold(val, a)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func docKind(val interface{}) string {
+	switch val.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	}
+
+	return fmt.Sprintf("%T", val)
+}
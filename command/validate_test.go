@@ -0,0 +1,111 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// validSpec is an app spec without any problem, the tests replace some of
+// its fields.
+const validSpec = `{
+	"appName": "web",
+	"cpus": 0.5,
+	"mem": 256,
+	"instances": 2,
+	"labels": {"team": "payments"},
+	"container": {
+		"type": "DOCKER",
+		"docker": {
+			"image": "nginx:1.11",
+			"network": "bridge",
+			"portMappings": [{"containerPort": 80, "name": "web", "protocol": "tcp"}]
+		}
+	},
+	"healthChecks": [{"protocol": "http", "path": "/", "portName": "web"}]
+}`
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  []string
+	}{
+		{
+			name:  "valid",
+			patch: `{}`,
+		},
+		{
+			name:  "unknown label key",
+			patch: `{"label": {"team": "payments"}}`,
+			want:  []string{`warning $.label: unknown field "label" is ignored, did you mean "labels"?`},
+		},
+		{
+			name:  "port name matching no port mapping",
+			patch: `{"healthChecks": [{"protocol": "tcp", "portName": "admin"}]}`,
+			want:  []string{`error $.healthChecks[0].portName: no port mapping named "admin"`},
+		},
+		{
+			name:  "negative instances",
+			patch: `{"instances": -1}`,
+			want:  []string{`error $.instances: must not be negative, got -1`},
+		},
+		{
+			name:  "mesos container",
+			patch: `{"container": {"type": "MESOS", "docker": {"image": "nginx:1.11", "portMappings": [{"containerPort": 80, "name": "web"}]}}}`,
+			want:  []string{`error $.container.type: unsupported container type "MESOS", only DOCKER is supported`},
+		},
+		{
+			name:  "lower case docker container",
+			patch: `{"container": {"type": "docker", "docker": {"image": "nginx:1.11", "portMappings": [{"containerPort": 80, "name": "web"}]}}}`,
+		},
+		{
+			name:  "map values in key order",
+			patch: `{"labels": {"team": 1, "env": true, "app": "web", "tier": null, "cost": []}}`,
+			want: []string{
+				`error $.labels.cost: expected a string, got an array`,
+				`error $.labels.env: expected a string, got a boolean`,
+				`error $.labels.team: expected a string, got a number`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		f := &specFile{Path: "app.json"}
+		if err := f.decode(patchSpec(t, validSpec, test.patch)); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		var got []string
+		for _, p := range validateSpec(f) {
+			got = append(got, fmt.Sprintf("%s %s: %s", p.Severity, p.Path, p.Message))
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got problems %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// patchSpec returns spec with the top level fields of patch replaced.
+func patchSpec(t *testing.T, spec, patch string) []byte {
+	var doc, fields map[string]interface{}
+	if err := json.Unmarshal([]byte(spec), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(patch), &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, val := range fields {
+		doc[key] = val
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
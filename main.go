@@ -12,14 +12,36 @@ func main() {
 	app.Name = "swancfg"
 	app.Usage = "command-line client for swan"
 	app.Version = "0.1"
+	app.Flags = command.GlobalFlags()
+	app.Before = command.Before
 
 	app.Commands = []cli.Command{
+		command.NewContextCommand(),
 		command.NewRemoteCommand(),
 		command.NewQuotaCommand(),
 		command.NewRunCommand(),
+		command.NewApplyCommand(),
+		command.NewUpdateCommand(),
+		command.NewScaleCommand(),
+		command.NewMigrateCommand(),
+		command.NewPromoteCommand(),
+		command.NewHistoryCommand(),
+		command.NewRollbackCommand(),
 		command.NewListCommand(),
 		command.NewInspectCommand(),
+		command.NewTaskCommand(),
+		command.NewLogsCommand(),
+		command.NewEventsCommand(),
+		command.NewTopCommand(),
+		command.NewValidateCommand(),
+		command.NewRenderCommand(),
+		command.NewDiffCommand(),
+		command.NewExportCommand(),
+		command.NewBackupCommand(),
+		command.NewRestoreCommand(),
 		command.NewDeleteCommand(),
+		command.NewProxyCommand(),
+		command.NewAuditCommand(),
 	}
 
 	if err := app.Run(os.Args); err != nil {
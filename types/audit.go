@@ -0,0 +1,24 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditRecord records a request of swancfg changing something in swan.
+// Status is zero when swan wasn't reached.
+type AuditRecord struct {
+	ID       uint64          `json:"id"`
+	Time     time.Time       `json:"time"`
+	User     string          `json:"user"`
+	Command  string          `json:"command"`
+	Context  string          `json:"context"`
+	Remote   string          `json:"remote"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	AppID    string          `json:"appId,omitempty"`
+	Spec     json.RawMessage `json:"spec,omitempty"`
+	Status   int             `json:"status"`
+	Duration time.Duration   `json:"duration"`
+	Error    string          `json:"error,omitempty"`
+}
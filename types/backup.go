@@ -0,0 +1,29 @@
+package types
+
+import (
+	"time"
+)
+
+// BackupManifest describes a backup archive: what was backed up from
+// where, and the checksum of every other file in the archive.
+type BackupManifest struct {
+	Version  int              `json:"version"`
+	Created  time.Time        `json:"created"`
+	Who      string           `json:"who"`
+	Clusters []*BackupCluster `json:"clusters"`
+	Files    []*BackupFile    `json:"files"`
+}
+
+// BackupCluster is a cluster whose apps are in a backup.
+type BackupCluster struct {
+	Name string `json:"name"`
+	Swan string `json:"swan"`
+	Apps int    `json:"apps"`
+}
+
+// BackupFile is a file of a backup archive with its sha256 checksum.
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
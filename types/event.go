@@ -0,0 +1,29 @@
+package types
+
+import (
+	"time"
+)
+
+const (
+	EventAppCreated       = "app_created"
+	EventAppDeleted       = "app_deleted"
+	EventAppStateChanged  = "app_state_changed"
+	EventTaskStarted      = "task_started"
+	EventTaskFailed       = "task_failed"
+	EventTaskStateChanged = "task_state_changed"
+	EventTaskRemoved      = "task_removed"
+	EventHealthChanged    = "health_changed"
+)
+
+// Event is a change in a cluster, either published by swan or derived
+// from successive app snapshots.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	AppId   string    `json:"appId,omitempty"`
+	TaskId  string    `json:"taskId,omitempty"`
+	RunAs   string    `json:"runAs,omitempty"`
+	State   string    `json:"state,omitempty"`
+	Healthy *bool     `json:"healthy,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
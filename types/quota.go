@@ -1,6 +1,32 @@
 package types
 
+import (
+	"time"
+)
+
+// Quota limits what the apps of a user may use in a cluster. Zero disk,
+// instances, apps and per-instance maximums mean no limit, so quotas
+// written before they existed keep working.
 type Quota struct {
-	Cpu    float64
-	Memory float64
+	Cpu       float64 `json:"cpu" yaml:"cpu"`
+	Memory    float64 `json:"memory" yaml:"memory"`
+	Disk      float64 `json:"disk,omitempty" yaml:"disk,omitempty"`
+	Instances int     `json:"instances,omitempty" yaml:"instances,omitempty"`
+	Apps      int     `json:"apps,omitempty" yaml:"apps,omitempty"`
+
+	// Largest instance the user may run.
+	MaxInstanceCpu    float64 `json:"maxInstanceCpu,omitempty" yaml:"maxInstanceCpu,omitempty"`
+	MaxInstanceMemory float64 `json:"maxInstanceMemory,omitempty" yaml:"maxInstanceMemory,omitempty"`
+}
+
+// QuotaChange records who changed the quota of a user in a cluster, and
+// how. Before is nil when the quota was created, After when it was removed.
+type QuotaChange struct {
+	Time    time.Time `json:"time"`
+	Who     string    `json:"who"`
+	Action  string    `json:"action"`
+	User    string    `json:"user"`
+	Cluster string    `json:"cluster"`
+	Before  *Quota    `json:"before,omitempty"`
+	After   *Quota    `json:"after,omitempty"`
 }
@@ -0,0 +1,13 @@
+package types
+
+import (
+	"time"
+)
+
+// Version is one revision of an app's spec as kept by swan.
+type Version struct {
+	ID      string    `json:"id,omitempty"`
+	Created time.Time `json:"created,omitempty"`
+
+	Spec
+}